@@ -0,0 +1,262 @@
+package column
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// A Format determines how the columnated grid is written.
+type Format int
+
+const (
+	// Text writes the grid as aligned plain text. This is the default.
+	Text Format = iota
+
+	// Markdown writes the grid as a GitHub-flavored Markdown table. The
+	// first row of the grid is used as the table's header. The Writer's
+	// width limits the number of columns as it does for Text, but the
+	// table markup is not counted. If the input is laid out as several
+	// grids, their rows are written as a single table.
+	Markdown
+
+	// CSV writes each row of the grid as a record of comma-separated values,
+	// as described in RFC 4180. Cells are not padded.
+	CSV
+
+	// TSV is like CSV, but separates values with tabs.
+	TSV
+
+	// Table writes the grid as aligned text with the columns separated by
+	// vertical lines. Every cell, including those in the last column, is
+	// padded to the width of its column. Any separator set with SetSeparator
+	// is ignored.
+	Table
+
+	// JSON writes the grid as a JSON array of rows, each an array of the
+	// strings in its cells, followed by a newline. Cells are not padded, and
+	// the cells missing at the end of short rows are left out rather than
+	// given as empty strings. If the input is laid out as several grids,
+	// their rows are written as a single array.
+	JSON
+)
+
+// tableSep separates the columns of a Table.
+const tableSep = " │ "
+
+// SetFormat sets the format used to write the grid.
+func (w *Writer) SetFormat(format Format) {
+	w.format = format
+}
+
+// SetRowTemplate causes each row of the grid to be written by executing t
+// with the row's cells, a []string, as its data, in place of the Writer's
+// format. The cells are not padded, and the cells missing at the end of short
+// rows are left out. Nothing is written between rows, so t should end with a
+// newline if one is wanted. If t is nil, which is the default, the format is
+// used.
+func (w *Writer) SetRowTemplate(t *template.Template) {
+	w.rowtmpl = t
+}
+
+// SetBorder controls whether a Table is enclosed in a box drawn with
+// box-drawing characters. The border counts toward the Writer's width. It
+// has no effect on other formats.
+func (w *Writer) SetBorder(on bool) {
+	w.border = on
+}
+
+// separator returns the string written between adjacent columns.
+func (w *Writer) separator() string {
+	if w.format == Table {
+		return tableSep
+	}
+	return w.sep
+}
+
+// padLast reports whether cells in the last column are padded.
+func (w *Writer) padLast() bool {
+	return w.padlast || w.format == Table || w.zebra != [2]string{} && w.colored()
+}
+
+// printsHeader reports whether the first line of input is taken as a header,
+// which only the Text and Table formats write.
+func (w *Writer) printsHeader() bool {
+	return w.headers && w.rowtmpl == nil && (w.format == Text || w.format == Table)
+}
+
+// borderwidth returns the total width of the left and right borders.
+func (w *Writer) borderwidth() int {
+	if w.border && w.format == Table {
+		return 4 // "│ " and " │"
+	}
+	return 0
+}
+
+// printRule writes a horizontal rule for the top or bottom of a bordered
+// Table, using the given corner and junction runes.
+func (w *Writer) printRule(cols []column, left, mid, right string) error {
+	segs := make([]string, len(cols))
+	for j, col := range cols {
+		segs[j] = strings.Repeat("─", col.width+w.lpad+w.rpad+2)
+	}
+	_, err := fmt.Fprintf(w.out, "%s%s%s%s\n", w.indent, left, strings.Join(segs, mid), right)
+	return err
+}
+
+// rows returns the cells of cols in row order. Rows at the bottom of a
+// ragged grid have fewer cells than the others; in a right-to-left grid, the
+// cells missing on the left are empty.
+func rows(cols []column) [][]string {
+	rowc := gridSize(cols).Rows
+	cells := make([][]string, rowc)
+	for i := range cells {
+		end := len(cols)
+		for end > 0 && i >= len(cols[end-1].words) {
+			end--
+		}
+		for _, col := range cols[:end] {
+			var word string
+			if i < len(col.words) {
+				word = col.words[i] // not missing unless right to left
+			}
+			cells[i] = append(cells[i], word)
+		}
+	}
+	return cells
+}
+
+// printFormat writes cols to the backing io.Writer in a format other than
+// Text.
+func (w *Writer) printFormat(cols []column) error {
+	switch w.format {
+	case CSV:
+		return w.printCSV(rows(cols), len(cols), ',')
+	case TSV:
+		return w.printCSV(rows(cols), len(cols), '\t')
+	}
+	return fmt.Errorf("column: unknown format %d", w.format)
+}
+
+// whole reports whether the grids of a Flush are written together, as a
+// single table, rather than one by one.
+func (w *Writer) whole() bool {
+	return w.rowtmpl == nil && (w.format == Markdown || w.format == JSON)
+}
+
+// printGrids writes the rows of all of grids together, in a format that
+// holds a single table. Each column takes its alignment from the first grid
+// that has it.
+func (w *Writer) printGrids(grids []grid) error {
+	var cells [][]string
+	var aligns []Align
+	for _, g := range grids {
+		cells = append(cells, rows(g.cols)...)
+		for j := len(aligns); j < len(g.cols); j++ {
+			aligns = append(aligns, g.cols[j].align)
+		}
+	}
+	if len(cells) == 0 {
+		return nil // nothing is written for no words, in any format
+	}
+	if w.format == JSON {
+		return w.printJSON(cells)
+	}
+	return w.printMarkdown(cells, aligns)
+}
+
+// printMarkdown writes cells as a Markdown table with a column for each of
+// aligns.
+func (w *Writer) printMarkdown(cells [][]string, aligns []Align) error {
+	if len(cells) == 0 {
+		return nil
+	}
+	ncols := len(aligns)
+
+	// escape cells and fill in the missing ones at the end of short rows
+	table := make([][]string, len(cells))
+	widths := make([]int, ncols)
+	for i := range widths {
+		widths[i] = 3 // minimum for the delimiter row
+	}
+	for i, row := range cells {
+		table[i] = make([]string, ncols)
+		for j, cell := range row {
+			table[i][j] = strings.Replace(cell, "|", `\|`, -1)
+			if l := w.strwidth(table[i][j]); l > widths[j] {
+				widths[j] = l
+			}
+		}
+	}
+
+	delim := make([]string, ncols)
+	for j, width := range widths {
+		dashes := strings.Repeat("-", width)
+		switch aligns[j] {
+		case Right, DecimalAlign:
+			delim[j] = dashes[1:] + ":"
+		case Center:
+			delim[j] = ":" + dashes[2:] + ":"
+		default:
+			delim[j] = dashes
+		}
+	}
+
+	if err := w.printMarkdownRow(table[0], widths, aligns); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.out, "| %s |\n", strings.Join(delim, " | ")); err != nil {
+		return err
+	}
+	for _, row := range table[1:] {
+		if err := w.printMarkdownRow(row, widths, aligns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printMarkdownRow writes one row of a Markdown table.
+func (w *Writer) printMarkdownRow(row []string, widths []int, aligns []Align) error {
+	padded := make([]string, len(row))
+	for j, cell := range row {
+		padded[j] = w.pad(cell, widths[j], aligns[j], false)
+	}
+	_, err := fmt.Fprintf(w.out, "| %s |\n", strings.Join(padded, " | "))
+	return err
+}
+
+// printCSV writes cells as records of ncols fields separated by comma. Missing
+// cells at the end of short rows are written as empty fields.
+func (w *Writer) printCSV(cells [][]string, ncols int, comma rune) error {
+	cw := csv.NewWriter(w.out)
+	cw.Comma = comma
+	for _, row := range cells {
+		record := make([]string, ncols)
+		copy(record, row)
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printJSON writes cells as a JSON array of arrays.
+func (w *Writer) printJSON(cells [][]string) error {
+	enc := json.NewEncoder(w.out)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(cells)
+}
+
+// printTemplate writes each row of cols by executing the row template.
+func (w *Writer) printTemplate(cols []column) error {
+	for i, row := range rows(cols) {
+		if err := w.rowtmpl.Execute(w.out, row); err != nil {
+			return &WriteError{Row: i, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package column
+
+import (
+	"bytes"
+	"io"
+)
+
+// A Grid is the layout of a Writer's buffered input, computed once with the
+// Writer's settings so that it can be inspected and written any number of
+// times. Later writes to the Writer, and changes to its settings, do not
+// affect a Grid.
+type Grid struct {
+	w     *Writer // private copy of the input and settings
+	cells [][]string
+	size  Size
+}
+
+// Grid lays out the Writer's buffered input as Flush would, without writing
+// it or discarding it. A width set with SetWidthAuto is measured once, when
+// the Grid is made.
+func (w *Writer) Grid() *Grid {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	g := &Grid{
+		w: &Writer{
+			buf:     bytes.NewBuffer(append([]byte(nil), w.buf.Bytes()...)),
+			options: w.options,
+		},
+	}
+	if w.autowidth {
+		// the copy has no backing io.Writer to measure
+		g.w.maxwidth, g.w.autowidth = termWidth(w.w), false
+	}
+	grids, _ := g.w.columnate() // reading from memory cannot fail
+	grids, _ = g.w.limit(grids)
+	for _, gr := range grids {
+		s := gridSize(gr.cols)
+		g.size.Rows += s.Rows
+		if s.Columns > g.size.Columns {
+			g.size.Columns = s.Columns
+		}
+		g.cells = append(g.cells, rows(gr.cols)...)
+	}
+	return g
+}
+
+// Columns returns the number of columns in the grid. If the input is laid
+// out as several grids, it reports the most columns of any of them.
+func (g *Grid) Columns() int {
+	return g.size.Columns
+}
+
+// Rows returns the number of rows in the grid, not counting any headers.
+func (g *Grid) Rows() int {
+	return g.size.Rows
+}
+
+// Cell returns the word in row r and column c of the grid, counting from 0.
+// It returns "" for a cell missing from a short row, or one outside the grid.
+func (g *Grid) Cell(r, c int) string {
+	if r < 0 || r >= len(g.cells) || c < 0 || c >= len(g.cells[r]) {
+		return ""
+	}
+	return g.cells[r][c]
+}
+
+// Render writes the grid to dst as Flush would have written it to the
+// Writer's backing io.Writer.
+func (g *Grid) Render(dst io.Writer) error {
+	g.w.mu.Lock()
+	defer g.w.mu.Unlock()
+	_, _, err := g.w.render(dst)
+	return err
+}
@@ -0,0 +1,172 @@
+package column
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// A lineWriter replaces the newlines written to it with a line terminator.
+// Each terminator is held back until more output follows, so that it can be
+// left off the final line.
+type lineWriter struct {
+	w       io.Writer
+	eol     string
+	pending bool
+}
+
+func (lw *lineWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if err := lw.end(); err != nil {
+			return n, err
+		}
+		line := p
+		i := bytes.IndexByte(p, '\n')
+		if i >= 0 {
+			line = p[:i]
+		}
+		if _, err := lw.w.Write(line); err != nil {
+			return n, err
+		}
+		n += len(line)
+		if i < 0 {
+			break
+		}
+		lw.pending = true
+		n++
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (lw *lineWriter) WriteString(s string) (int, error) {
+	return lw.Write([]byte(s))
+}
+
+// end writes the terminator that is being held back, if any.
+func (lw *lineWriter) end() error {
+	if !lw.pending {
+		return nil
+	}
+	lw.pending = false
+	_, err := io.WriteString(lw.w, lw.eol)
+	return err
+}
+
+// A trimWriter removes the spaces and tabs at the end of each line written
+// to it. Each run of them is held back until the rest of the line shows
+// whether it is trailing. What remains of each Write is passed on in one
+// Write.
+type trimWriter struct {
+	w       io.Writer
+	pending []byte
+	buf     []byte
+}
+
+func (tw *trimWriter) Write(p []byte) (n int, err error) {
+	out := tw.buf[:0]
+	for rest := p; len(rest) > 0; {
+		line := rest
+		i := bytes.IndexByte(rest, '\n')
+		if i >= 0 {
+			line = rest[:i]
+		}
+		text := bytes.TrimRight(line, " \t")
+		if len(text) > 0 {
+			out = append(append(out, tw.pending...), text...)
+			tw.pending = tw.pending[:0]
+		}
+		tw.pending = append(tw.pending, line[len(text):]...)
+		if i < 0 {
+			break
+		}
+		tw.pending = tw.pending[:0]
+		out = append(out, '\n')
+		rest = rest[i+1:]
+	}
+	tw.buf = out
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	// the bytes written are no more than those of p they came from
+	if m, err := tw.w.Write(out); err != nil {
+		return m, err
+	}
+	return len(p), nil
+}
+
+func (tw *trimWriter) WriteString(s string) (int, error) {
+	return tw.Write([]byte(s))
+}
+
+// A countWriter counts the bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += n
+	return n, err
+}
+
+func (cw *countWriter) WriteString(s string) (int, error) {
+	n, err := io.WriteString(cw.w, s)
+	cw.n += n
+	return n, err
+}
+
+// Output is the grid for a Writer's buffered input, formatted on demand with
+// the Writer's settings at the time it is read or written. Unlike Flush,
+// reading an Output does not discard the buffered input.
+type Output struct {
+	w   *Writer
+	mu  sync.Mutex    // guards buf
+	buf *bytes.Buffer // formatted grid, once Read is called
+}
+
+// Output returns the grid for the Writer's buffered input as an io.Reader
+// and io.WriterTo, so that it can be passed to io.Copy.
+func (w *Writer) Output() *Output {
+	return &Output{w: w}
+}
+
+// WriteTo formats the grid and writes it to dst. Each call formats the grid
+// afresh, even after a call to Read.
+func (o *Output) WriteTo(dst io.Writer) (int64, error) {
+	o.w.mu.Lock()
+	defer o.w.mu.Unlock()
+	_, n, err := o.w.render(dst)
+	return int64(n), err
+}
+
+// Read reads from the formatted grid. The grid is formatted on the first
+// call, and later calls read the rest of it. Concurrent calls each read a
+// different part of the grid.
+func (o *Output) Read(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.buf == nil {
+		o.buf = &bytes.Buffer{}
+		if _, err := o.WriteTo(o.buf); err != nil {
+			return 0, err
+		}
+	}
+	return o.buf.Read(p)
+}
+
+// Bytes returns the grid for the Writer's buffered input, formatted as Flush
+// would write it. Like Output, it does not discard the buffered input.
+func (w *Writer) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var buf bytes.Buffer
+	w.render(&buf) // writing to a bytes.Buffer cannot fail
+	return buf.Bytes()
+}
+
+// String is like Bytes, but returns the grid as a string.
+func (w *Writer) String() string {
+	return string(w.Bytes())
+}
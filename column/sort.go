@@ -0,0 +1,100 @@
+package column
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+)
+
+// sortWords sorts words according to the Writer's sort settings.
+func (w *Writer) sortWords(words []string) {
+	compare := strings.Compare
+	if w.collated {
+		var opts []collate.Option
+		if w.natural {
+			opts = append(opts, collate.Numeric)
+		}
+		compare = collate.New(w.collation, opts...).CompareString
+	} else if w.natural {
+		compare = naturalCompare
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return w.less(compare, words[i], words[j])
+	})
+}
+
+// less reports whether a sorts before b according to compare.
+func (w *Writer) less(compare func(a, b string) int, a, b string) bool {
+	if w.reverse {
+		a, b = b, a
+	}
+	if w.casefold {
+		if c := compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+			return c < 0
+		}
+	}
+	if c := compare(a, b); c != 0 {
+		return c < 0
+	}
+	return a < b
+}
+
+// naturalCompare compares a and b like strings.Compare, except that runs of
+// decimal digits are compared by numeric value. Runs with equal value but
+// different numbers of leading zeros are ordered shortest first, but only if
+// the strings are otherwise equal.
+func naturalCompare(a, b string) int {
+	var tie int
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			da, db := digits(a), digits(b)
+			na, nb := strings.TrimLeft(a[:da], "0"), strings.TrimLeft(b[:db], "0")
+			if len(na) != len(nb) {
+				return sign(len(na) - len(nb))
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			if tie == 0 {
+				tie = sign(da - db)
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			return sign(int(ra) - int(rb))
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return tie
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digits returns the length of the run of decimal digits at the start of s.
+func digits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
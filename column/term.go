@@ -0,0 +1,25 @@
+package column
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// defaultTermWidth is the width assumed when the terminal size is unknown.
+const defaultTermWidth = 80
+
+// termWidth returns the width of the terminal w refers to, or
+// defaultTermWidth if w is not a terminal.
+func termWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return defaultTermWidth
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 {
+		return defaultTermWidth
+	}
+	return width
+}
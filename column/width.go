@@ -0,0 +1,160 @@
+package column
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// strwidth returns the number of terminal cells needed to display s. If the
+// Writer is ANSI-aware, escape sequences are not counted.
+func (w *Writer) strwidth(s string) int {
+	if w.widthfunc != nil {
+		return w.widthfunc(s)
+	}
+	var n int
+	for len(s) > 0 {
+		size, cells := w.next(s)
+		n += cells
+		s = s[size:]
+	}
+	return n
+}
+
+// next returns the length in bytes and the width in cells of the first unit
+// of s that is measured as a whole: an escape sequence, a grapheme cluster or
+// a rune, depending on the Writer's settings.
+func (w *Writer) next(s string) (size, cells int) {
+	if w.ansi && s[0] == '\x1b' {
+		return len(s) - len(skipEscape(s)), 0
+	}
+	if w.graphemes {
+		size, cells = cluster(s)
+	} else {
+		var r rune
+		r, size = utf8.DecodeRuneInString(s)
+		cells = runewidth(r)
+	}
+	if w.widthfunc != nil {
+		cells = w.widthfunc(s[:size])
+	}
+	return size, cells
+}
+
+// skipEscape returns s with the leading ECMA-48 control sequence removed.
+// s must begin with an escape character. An unterminated sequence consumes
+// the rest of s.
+func skipEscape(s string) string {
+	s = s[1:]
+	if len(s) == 0 || s[0] != '[' {
+		return s
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return s[i+1:]
+		}
+	}
+	return ""
+}
+
+// sgrReset is the SGR sequence that turns off all attributes.
+const sgrReset = "\x1b[0m"
+
+// closeSGR returns s followed by a reset if s leaves any SGR attributes in
+// effect at its end.
+func closeSGR(s string) string {
+	var open bool
+	for rest := s; ; {
+		i := strings.IndexByte(rest, '\x1b')
+		if i < 0 {
+			break
+		}
+		after := skipEscape(rest[i:])
+		seq := rest[i : len(rest)-len(after)]
+		if strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+			params := strings.Trim(seq[2:len(seq)-1], "0;")
+			open = params != ""
+		}
+		rest = after
+	}
+	if open {
+		return s + sgrReset
+	}
+	return s
+}
+
+// runewidth returns the number of terminal cells needed to display r.
+// East Asian wide and fullwidth runes occupy two cells; everything else
+// occupies one.
+func runewidth(r rune) int {
+	if r < 0x1100 {
+		return 1 // no wide runes precede Hangul Jamo
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+const (
+	zwj        = '\u200d' // zero width joiner
+	emojiStyle = '\ufe0f' // variation selector requesting emoji presentation
+)
+
+// cluster returns the length in bytes and the width in cells of the grapheme
+// cluster at the start of s. It covers the common cases of Unicode Standard
+// Annex #29 rather than the full algorithm: combining marks, variation
+// selectors, emoji modifiers and tags, zero width joiner sequences, and
+// pairs of regional indicators. A cluster is as wide as its first rune,
+// unless it requests emoji presentation or forms a flag, in which case it is
+// two cells wide.
+func cluster(s string) (size, cells int) {
+	r, size := utf8.DecodeRuneInString(s)
+	cells = runewidth(r)
+	if isRegional(r) {
+		if r, n := utf8.DecodeRuneInString(s[size:]); isRegional(r) {
+			return size + n, 2
+		}
+		return size, cells
+	}
+	for size < len(s) {
+		r, n := utf8.DecodeRuneInString(s[size:])
+		switch {
+		case r == zwj:
+			// the joiner and the rune it joins belong to this cluster
+			size += n
+			if size < len(s) {
+				_, n = utf8.DecodeRuneInString(s[size:])
+				size += n
+			}
+		case r == emojiStyle:
+			size += n
+			cells = 2
+		case isExtend(r):
+			size += n
+		default:
+			return size, cells
+		}
+	}
+	return size, cells
+}
+
+// isRegional reports whether r is a regional indicator symbol, two of which
+// form a flag.
+func isRegional(r rune) bool {
+	return 0x1f1e6 <= r && r <= 0x1f1ff
+}
+
+// isExtend reports whether r extends the grapheme cluster before it.
+func isExtend(r rune) bool {
+	switch {
+	case 0x1f3fb <= r && r <= 0x1f3ff: // emoji modifiers
+		return true
+	case 0xe0020 <= r && r <= 0xe007f: // tags
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me)
+}
@@ -2,136 +2,2405 @@
 package column // import "sigint.ca/text/column"
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
 // A Writer is an io.Writer which filters text by arranging it into columns.
+//
+// Write, WriteString, WriteByte, WriteRune, ReadFrom, Flush, FlushSize,
+// FlushN, FlushReader, FlushTo, FitColumns, RowsFor, Fits, Layout,
+// LastColumns, Grid, Bytes, String, Reset and Close, and reads of an Output,
+// may be called concurrently; each call is serialized with the others. The
+// order in which concurrent writes and flushes take effect is up to the
+// caller. The Set methods configure the Writer and must not be called
+// concurrently with any other method.
 type Writer struct {
-	buf      *bytes.Buffer
-	w        io.Writer
-	maxwidth int
-	colwidth int
+	mu     sync.Mutex
+	buf    *bytes.Buffer
+	w      io.Writer
+	in     io.Reader
+	closed bool
+	options
+
+	// current state
+	out    io.Writer // destination of the Flush in progress
+	indent string    // written before each line of the grid being printed
+	src    io.Reader // input following the buffer, if not nil
+	header string    // header of the grid being laid out, if headers is set
+	hwidth int       // width of header
+	kept   bool      // header taken by an earlier automatic flush
+	titled bool      // header written in the Flush in progress, or none taken
+	nlines int       // lines buffered, if autoflush is set
+	ncols  int       // columns in the grid last flushed
+	ints   []int     // integer widths of the words being laid out, if any
+
+	// storage reused from one Flush to the next
+	wordbuf  []string
+	widthbuf []int
+	colbuf   []column
+	fillbuf  []string
+	cellbuf  [][]string
+	linebuf  []string
+	outbuf   []byte // a line of output
+	offbuf   []int  // where each cell of outbuf starts
+	intbuf   []int
+}
+
+// options holds the settings of a Writer.
+type options struct {
+	maxwidth  int
+	autowidth bool
+	sep       string
+	gapfrac   float64
+	gapmin    int
+	ansi      bool
+	order     Order
+	balanced  bool
+	rtl       bool
+	align     Align
+	tabwidth  int
+	recsep    string
+	autoflush int
+	mincols   int
+	maxcols   int
+	columns   int
+	sort      bool
+	casefold  bool
+	reverse   bool
+	natural   bool
+	collated  bool
+	collation language.Tag
+	unique    bool
+	normalize bool
+	normform  norm.Form
+	skipblank bool
+	grouping  bool
+	spans     func(string) bool
+	trim      bool
+	maxcell   int
+	mincell   int
+	lpad      int
+	rpad      int
+	wrap      bool
+	padlast   bool
+	trimtrail bool
+	padrune   rune
+	zebra     [2]string
+	forced    bool
+	format    Format
+	rowtmpl   *template.Template
+	justify   bool
+	block     Align
+	oneline   bool
+	flushlast bool
+	graphemes bool
+	widthfunc func(string) int
+	border    bool
+	headers   bool
+	hrepeat   int
+	numbered  bool
+	autoalign bool
+	colaligns []Align
+	colwidths []int
+	spill     bool
+	fieldsep  string
+	fieldrows bool
+	eol       string
+	trailing  bool
+	maxrows   int
+	overflow  string
+}
+
+// ErrClosed is returned by Write when the Writer has been closed.
+var ErrClosed = errors.New("column: write to closed Writer")
+
+// A WriteError reports where in the grid a write to the backing io.Writer
+// failed, when writing the Text or Table format. The output before that cell
+// has been written; the rest of the row has not.
+type WriteError struct {
+	Row    int // row of the grid, counting from 0 across all grids of a Flush
+	Column int // column of the grid, counting from 0
+	Err    error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("column: write failed at row %d, column %d: %v", e.Row, e.Column, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// A ReadError reports that reading the input to be columnated failed, as
+// distinct from writing the output. Nothing has been written.
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("column: read failed: %v", e.Err)
 }
 
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// offset moves err down by the given number of rows, if it is a *WriteError.
+func offset(err error, rows int) error {
+	if we, ok := err.(*WriteError); ok {
+		we.Row += rows
+	}
+	return err
+}
+
+// An Order determines how words are assigned to the cells of the grid.
+type Order int
+
+const (
+	// ColumnMajor fills each column from top to bottom before moving on to
+	// the next column, like ls(1). The columns are balanced, so that their
+	// heights differ by at most one: when n words are arranged in c columns,
+	// the first n%c columns hold n/c+1 words each, and the rest n/c words
+	// each. For example, 7 words in 3 columns are held 3, 2 and 2. See
+	// SetBalanced for the alternative. This is the default.
+	ColumnMajor Order = iota
+
+	// RowMajor fills each row from left to right before moving on to the
+	// next row, like ls -x. Only the last row may be short.
+	RowMajor
+)
+
+// An Align determines how a word is positioned within its cell.
+type Align int
+
+const (
+	// Left pads words on the right. This is the default.
+	Left Align = iota
+
+	// Right pads words on the left.
+	Right
+
+	// Center pads words evenly on both sides, with any odd cell of padding
+	// on the right.
+	Center
+
+	// DecimalAlign pads words so that their decimal points line up, treating
+	// a word without one as having an empty fraction. A column is widened if
+	// need be to hold its longest integer and fractional parts. Where there is
+	// no column to align with, as in Markdown, it behaves like Right.
+	DecimalAlign
+)
+
 // NewWriter returns a new column.Writer. Text written to this writer will be
 // arranged so that its combined width does not exceed the given width, and then
-// written to w when flushed by calling Flush().
+// written to w when flushed by calling Flush(). If width is 0 or less, the
+// width is unlimited and text is arranged in a single column.
 func NewWriter(w io.Writer, width int) *Writer {
 	return &Writer{
-		buf:      &bytes.Buffer{},
-		w:        w,
-		maxwidth: width,
+		buf: &bytes.Buffer{},
+		w:   w,
+		options: options{
+			maxwidth: width,
+			sep:      " ",
+			tabwidth: 8,
+			recsep:   "\n",
+			padrune:  ' ',
+			eol:      "\n",
+			trailing: true,
+			balanced: true,
+			overflow: "… and %d more",
+		},
+	}
+}
+
+// NewReaderWriter is like NewWriter, but the returned Writer also reads
+// input from r. Each Flush, FlushSize, FlushN or FlushReader, and so each
+// Close, columnates the buffered input followed by the lines read from r
+// until io.EOF, as FlushReader does. FlushTo reads the rest of r into the
+// buffer, so that its later calls see it too. The other methods see only the
+// buffered input. If reading from r fails, the error is returned as a
+// *ReadError.
+func NewReaderWriter(r io.Reader, w io.Writer, width int) *Writer {
+	cw := NewWriter(w, width)
+	cw.in = r
+	return cw
+}
+
+// Print arranges items into columns no wider than width and writes them to
+// w, with the default settings of a Writer. An item containing a newline is
+// treated as several items.
+func Print(w io.Writer, width int, items []string) error {
+	cw := NewWriter(w, width)
+	for _, item := range items {
+		cw.buf.WriteString(item)
+		cw.buf.WriteByte('\n')
+	}
+	return cw.Flush()
+}
+
+// Sprint is like Print, but returns the columnated items as a string.
+func Sprint(width int, items []string) string {
+	var buf bytes.Buffer
+	Print(&buf, width, items) // writing to a bytes.Buffer cannot fail
+	return buf.String()
+}
+
+// SetWidth sets the width that the output of the next Flush must not exceed.
+// As with NewWriter, a width of 0 or less produces a single column. SetWidth
+// cancels the effect of SetWidthAuto.
+func (w *Writer) SetWidth(width int) {
+	w.maxwidth = width
+	w.autowidth = false
+}
+
+// SetWidthAuto causes each Flush to use the width of the terminal that the
+// backing io.Writer refers to. If the backing io.Writer is not a terminal,
+// a width of 80 is used.
+func (w *Writer) SetWidthAuto() {
+	w.autowidth = true
+}
+
+// Width returns the width that the output of the next Flush must not exceed.
+func (w *Writer) Width() int {
+	if w.autowidth {
+		return termWidth(w.w)
+	}
+	return w.maxwidth
+}
+
+// SetANSIAware controls whether ANSI SGR escape sequences (such as
+// "\x1b[31m") are ignored when measuring the width of the input. The
+// sequences are still written to the output, but a word that leaves
+// attributes such as color in effect is followed by a reset, so that they do
+// not bleed into the padding and separators around it. It is off by default.
+func (w *Writer) SetANSIAware(on bool) {
+	w.ansi = on
+}
+
+// SetGraphemeAware controls whether widths are measured by grapheme cluster
+// rather than by rune. When it is on, combining marks, emoji modifiers and
+// zero-width joiner sequences are measured together with the rune they
+// modify, and words are never truncated or wrapped inside a cluster. It is
+// off by default, since it is slower.
+func (w *Writer) SetGraphemeAware(on bool) {
+	w.graphemes = on
+}
+
+// SetWidthFunc sets the function used to measure the width of a word in
+// cells, in place of the built-in measurement, which accounts for wide runes
+// and the settings of SetANSIAware and SetGraphemeAware. Where a word must be
+// divided, as when truncating, wrapping or expanding tabs, f is applied to each
+// rune, or grapheme cluster if SetGraphemeAware is on, and escape sequences
+// still count for nothing if SetANSIAware is on. If f is nil, the built-in
+// measurement is restored.
+func (w *Writer) SetWidthFunc(f func(string) int) {
+	w.widthfunc = f
+}
+
+// SetGap sets the number of spaces placed between adjacent columns. The
+// default is 1. A negative gap is treated as 0. SetGap replaces any
+// separator set with SetSeparator, and any gap set with SetProportionalGap.
+func (w *Writer) SetGap(n int) {
+	if n < 0 {
+		n = 0
+	}
+	w.sep = strings.Repeat(" ", n)
+	w.gapfrac = 0
+}
+
+// SetProportionalGap causes the spaces following each column to number the
+// given fraction of the column's width, rounded down, but at least min. For
+// example, SetProportionalGap(0.25, 1) puts 2 spaces after a column 8 cells
+// wide, and 1 after a column 4 cells wide. The gaps count toward the Writer's
+// width. It replaces any separator set with SetSeparator or SetGap, has no
+// effect on the Table format, and is disabled by a fraction of 0 or less.
+func (w *Writer) SetProportionalGap(fraction float64, min int) {
+	w.gapfrac, w.gapmin = fraction, min
+}
+
+// proportional reports whether the gaps between columns are proportional to
+// their widths, as set by SetProportionalGap.
+func (w *Writer) proportional() bool {
+	return w.gapfrac > 0 && w.format != Table
+}
+
+// gap returns the number of spaces following a column of the given width, if
+// the gaps are proportional.
+func (w *Writer) gap(width int) int {
+	n := int(w.gapfrac * float64(width))
+	if n < w.gapmin {
+		n = w.gapmin
+	}
+	return n
+}
+
+// SetSeparator sets the string placed between adjacent columns. Each cell is
+// padded to its column's width before the separator is written, and no
+// separator follows the last cell of a row, even in a short row. The
+// separator's width is measured in the same way as the words', so it may
+// contain wide characters. SetSeparator replaces any gap set with
+// SetProportionalGap.
+func (w *Writer) SetSeparator(sep string) {
+	w.sep = sep
+	w.gapfrac = 0
+}
+
+// SetRTL controls whether columns are filled from right to left, for scripts
+// written in that direction. The first word is placed in the top right cell,
+// and the order set by SetOrder proceeds leftward from there. Rows that are
+// short of words are short on the left. It is off by default.
+func (w *Writer) SetRTL(on bool) {
+	w.rtl = on
+}
+
+// SetAlign sets the alignment of words within their cells.
+func (w *Writer) SetAlign(align Align) {
+	w.align = align
+}
+
+// SetAutoAlign controls whether columns in which every word is a number are
+// right-aligned, regardless of the alignment set by SetAlign. A word is a
+// number if strconv.ParseFloat accepts it, ignoring surrounding spaces. It is
+// off by default.
+func (w *Writer) SetAutoAlign(on bool) {
+	w.autoalign = on
+}
+
+// SetFieldDelimiter causes lines containing sep to be treated as rows of
+// fields rather than as words. Each run of consecutive delimited lines is
+// aligned as a table, like text/tabwriter, with a column for each field;
+// rows with fewer fields than others are left short. Runs of other lines are
+// packed into columns as usual, and the grids are written in input order.
+// A header is written only above the first grid. If sep is empty, which is
+// the default, every line is a word. SetFieldDelimiter cancels the effect of
+// SetTableFromFields.
+func (w *Writer) SetFieldDelimiter(sep string) {
+	w.fieldsep = sep
+	w.fieldrows = false
+}
+
+// SetTableFromFields makes Flush treat every line as a row of fields
+// separated by sep, and align the fields in columns as a table, like
+// column -t. A line without sep is a row of one field. If sep is empty,
+// fields are separated by runs of white space. SetFieldDelimiter cancels the
+// effect of SetTableFromFields.
+func (w *Writer) SetTableFromFields(sep string) {
+	w.fieldsep = sep
+	w.fieldrows = true
+}
+
+// SetLineTerminator sets the string written at the end of each line of
+// output, such as "\r\n". The default is "\n".
+func (w *Writer) SetLineTerminator(s string) {
+	w.eol = s
+}
+
+// SetTrailingNewline controls whether the final line written by Flush is
+// terminated. It is on by default; turning it off helps when the output is
+// embedded in a larger document.
+func (w *Writer) SetTrailingNewline(on bool) {
+	w.trailing = on
+}
+
+// SetRecordSeparator sets the string that separates words in the input, such
+// as "\x00" for the output of find -print0. As with newlines, a separator at
+// the end of the input does not start another word. Carriage returns are
+// removed only with the default separator, "\n"; an empty sep restores it.
+func (w *Writer) SetRecordSeparator(sep string) {
+	if sep == "" {
+		sep = "\n"
+	}
+	w.recsep = sep
+}
+
+// SetAutoFlushLines makes the Writer flush automatically whenever at least n
+// complete lines are buffered, so that long-running output appears as it is
+// produced. A partial line at the end of the buffer waits for the next batch.
+// Each batch is arranged independently, so the number and widths of the
+// columns may differ from one batch to the next. With SetHeader, the header
+// is taken from the first line of the first batch and written again above
+// the later ones, until the Writer is flushed explicitly or Reset. If n is 0,
+// which is the default, the Writer flushes only when told to.
+func (w *Writer) SetAutoFlushLines(n int) {
+	w.autoflush = n
+}
+
+// SetColumnAligns sets the alignment of each column, counting from the left,
+// overriding SetAlign and SetAutoAlign. Columns beyond the end of aligns use
+// the alignment set by SetAlign, which is Left by default. Since the number
+// of columns in a packed grid depends on the width, this is most useful with
+// SetColumns, or with the tables of SetFieldDelimiter and SetTableFromFields,
+// where each column holds one field.
+func (w *Writer) SetColumnAligns(aligns []Align) {
+	w.colaligns = aligns
+}
+
+// SetColumnWidths sets the width of each column, counting from the left, and
+// arranges the words into exactly len(widths) columns as with SetColumns,
+// however wide the result. Words wider than their column are truncated with
+// an ellipsis, or written in full if SetCellOverflow is on; narrower words
+// are padded. A width of 0 or less leaves that column as wide as its widest
+// word. The widths also apply to the tables of SetFieldDelimiter and
+// SetTableFromFields, whose number of columns is set by their fields. A nil
+// widths restores the default, where the widths and the number of columns
+// are chosen to fit the Writer's width.
+func (w *Writer) SetColumnWidths(widths []int) {
+	w.colwidths = widths
+	w.columns = len(widths)
+}
+
+// SetCellOverflow controls whether words wider than a width set with
+// SetColumnWidths are written in full, pushing the rest of their line to the
+// right, rather than truncated. It is off by default.
+func (w *Writer) SetCellOverflow(on bool) {
+	w.spill = on
+}
+
+// SetMaxColumns limits the number of columns to n, even if more would fit.
+// If n is 0, the number of columns is limited only by the width.
+func (w *Writer) SetMaxColumns(n int) {
+	w.maxcols = n
+}
+
+// SetMinColumns makes Flush use at least n columns whenever there are at
+// least n words, even if the result is wider than the Writer's width. If
+// both are set, the minimum takes precedence over the maximum set with
+// SetMaxColumns.
+func (w *Writer) SetMinColumns(n int) {
+	w.mincols = n
+}
+
+// SetColumns makes Flush arrange the words into exactly n columns, however
+// wide the result, ignoring the Writer's width and the limits set with
+// SetMinColumns and SetMaxColumns. If there are fewer than n words, the extra
+// columns are left off. If n is 0, which is the default, the number of columns
+// is chosen to fit the width.
+func (w *Writer) SetColumns(n int) {
+	w.columns = n
+}
+
+// SetSort controls whether words are sorted before they are arranged into
+// columns. It is off by default.
+func (w *Writer) SetSort(on bool) {
+	w.sort = on
+}
+
+// SetSortOptions adjusts the comparison used when sorting is enabled. If
+// caseFold is true, words that differ only in case sort together. If reverse
+// is true, words are sorted in descending order.
+func (w *Writer) SetSortOptions(caseFold, reverse bool) {
+	w.casefold = caseFold
+	w.reverse = reverse
+}
+
+// SetNaturalSort controls whether sorting compares runs of digits by their
+// numeric value, so that "file2" sorts before "file10". It takes effect only
+// when sorting is enabled, and combines with the options set by
+// SetSortOptions.
+func (w *Writer) SetNaturalSort(on bool) {
+	w.natural = on
+}
+
+// SetCollation causes sorting to follow the collation rules of the language
+// identified by tag, rather than comparing bytes, so that accented letters
+// and the like sort where a reader of that language expects. It combines with
+// SetNaturalSort and SetSortOptions, and takes effect only when sorting is
+// enabled.
+func (w *Writer) SetCollation(tag language.Tag) {
+	w.collated = true
+	w.collation = tag
+}
+
+// SetNormalize causes each line of input to be converted to the Unicode
+// normalization form f, such as norm.NFC, before it is measured and sorted, so
+// that text measures and orders the same way however its accents were
+// encoded. Normalized text is also what is written.
+func (w *Writer) SetNormalize(f norm.Form) {
+	w.normalize = true
+	w.normform = f
+}
+
+// SetSpanningLines causes each line of input for which spans returns true to
+// be written on a line of its own, as is, rather than placed in a cell, such
+// as for a section heading. The words before and after it are arranged into
+// columns separately, and it is not counted in their widths. A spanning line
+// is one row of the output, as counted by FlushSize, SetMaxRows and the like.
+// It is subject to sorting and filtering like any other line, but not to
+// truncation by SetMaxCellWidth, and in formats other than Text and Table it
+// is written as a row of one cell. If spans is nil, which is the default, no
+// lines span.
+func (w *Writer) SetSpanningLines(spans func(line string) bool) {
+	w.spans = spans
+}
+
+// SetGroupOnBlank controls whether blank lines divide the input into groups
+// that are arranged into columns independently, each with its own number of
+// columns and column widths. The groups are written one after another,
+// separated by the blank lines. SetSkipBlank takes precedence. It is off by
+// default.
+func (w *Writer) SetGroupOnBlank(on bool) {
+	w.grouping = on
+}
+
+// SetTrim controls whether leading and trailing white space is removed from
+// each word before it is measured. It is off by default, so indentation is
+// preserved and counts toward a word's width.
+func (w *Writer) SetTrim(on bool) {
+	w.trim = on
+}
+
+// SetMaxCellWidth truncates words wider than n cells, replacing the end of
+// each with an ellipsis ("…") so that it fits. If n is 0 or less, words are
+// never truncated.
+func (w *Writer) SetMaxCellWidth(n int) {
+	w.maxcell = n
+}
+
+// SetMinCellWidth makes every column at least n cells wide, however narrow
+// its words, like the minwidth of text/tabwriter. Wider columns mean fewer of
+// them fit in the Writer's width. If n is 0, which is the default, a column is
+// as wide as its widest word.
+func (w *Writer) SetMinCellWidth(n int) {
+	w.mincell = n
+}
+
+// SetCellPadding sets the number of spaces written inside each cell, before
+// and after its word, in addition to any padding for alignment. Unlike the
+// gap between columns, the padding lies within a Table's borders. Padding
+// after the last word on a line is omitted unless SetPadLastColumn is on.
+// Cell padding applies to the Text and Table formats, and is 0 by default.
+func (w *Writer) SetCellPadding(left, right int) {
+	w.lpad, w.rpad = left, right
+}
+
+// SetWrap controls whether words that are too wide are wrapped onto
+// continuation lines within their cell rather than truncated. Words are
+// wrapped at the last space that fits, or wherever necessary if there is
+// none. The limit is the width set with SetMaxCellWidth, or the Writer's
+// width if that is not set. It is off by default.
+func (w *Writer) SetWrap(on bool) {
+	w.wrap = on
+}
+
+// SetPadLastColumn controls whether cells in the last column, and missing
+// cells at the end of short rows, are padded so that every line of output has
+// the same width. It is off by default.
+func (w *Writer) SetPadLastColumn(on bool) {
+	w.padlast = on
+}
+
+// SetTrimTrailing controls whether spaces and tabs at the end of each line
+// are removed before it is terminated, however they came to be there: from
+// padding the last column, from the words themselves, or from the separator
+// before an empty cell. It applies to the Text and Table formats, and has no
+// effect while SetPadLastColumn(true) is in force. It is off by default.
+func (w *Writer) SetTrimTrailing(on bool) {
+	w.trimtrail = on
+}
+
+// SetPadRune sets the rune used to pad words to the width of their column.
+// The default is a space. Empty cells are always padded with spaces, and the
+// separator between columns is not affected.
+func (w *Writer) SetPadRune(r rune) {
+	w.padrune = r
+}
+
+// SetSkipBlank controls whether empty and all-whitespace words are discarded
+// before layout. It is off by default.
+func (w *Writer) SetSkipBlank(on bool) {
+	w.skipblank = on
+}
+
+// SetUnique controls whether repeated words are discarded before layout.
+// Only the first occurrence of each word is kept. It is off by default.
+func (w *Writer) SetUnique(on bool) {
+	w.unique = on
+}
+
+// SetBlockAlign sets the position of the grid as a whole within the Writer's
+// width. With Right or Center, each line of the grid is indented by all or
+// half of the space left over once the grid is laid out, keeping the grid one
+// cell narrower than the width as the fitting does. A grid made to span the
+// width by SetJustify or SetJustifyLast has no space left over. It applies to
+// the Text and Table formats, and has no effect if the width is unlimited. The
+// default is Left.
+func (w *Writer) SetBlockAlign(align Align) {
+	w.block = align
+}
+
+// setIndent sets the indentation of a grid of the given width, as determined
+// by SetBlockAlign.
+func (w *Writer) setIndent(width int) {
+	w.indent = ""
+	extra := w.maxwidth - 1 - width
+	if w.maxwidth <= 0 || extra <= 0 {
+		return
+	}
+	switch w.block {
+	case Right:
+		w.indent = w.padding(extra, "")
+	case Center:
+		w.indent = w.padding(extra/2, "")
+	}
+}
+
+// SetJustify controls whether the space left over after choosing the number
+// of columns is distributed among the gaps between them, so that the grid
+// spans the Writer's width. As with the fitting itself, the grid is kept
+// one cell narrower than the width. Space that does not divide evenly goes
+// to the leftmost gaps. It is off by default.
+func (w *Writer) SetJustify(on bool) {
+	w.justify = on
+}
+
+// SetJustifyLast controls whether the space left over after choosing the
+// number of columns is added to the gap before the last column, so that the
+// last column meets the right edge of the grid as with SetJustify, while the
+// other gaps keep the width set by SetGap. If there is no space left over, or
+// only one column, the grid is unchanged. SetJustify takes precedence. It is
+// off by default.
+func (w *Writer) SetJustifyLast(on bool) {
+	w.flushlast = on
+}
+
+// SetSingleLineWhenFits controls whether words that fit within the width all
+// together are written on a single line, joined by the separator, rather than
+// arranged into a grid. The line is written as is, without a header and
+// without the padding, column limits or justification that a grid would
+// have. It applies only to the Text format, and not to right-to-left output.
+// It is off by default.
+func (w *Writer) SetSingleLineWhenFits(on bool) {
+	w.oneline = on
+}
+
+// SetMaxRows limits the grid written by Flush to n rows. The number of
+// columns is chosen first, as if there were no limit, and then the rows past
+// the nth are left off. If any words are left off, a line reporting how many
+// is written after the grid, counting a row of fields as one word; see
+// SetOverflowFormat. If the input is written as several grids, the limit
+// applies to their rows altogether. If n is 0, which is the default, there is
+// no limit.
+func (w *Writer) SetMaxRows(n int) {
+	w.maxrows = n
+}
+
+// SetOverflowFormat sets the format of the line written after a grid that
+// was cut short by SetMaxRows. It is passed to fmt.Sprintf with the number of
+// words left off, and the default is "… and %d more". The line is written only
+// for the Text and Table formats, and not when a row template is set.
+func (w *Writer) SetOverflowFormat(format string) {
+	w.overflow = format
+}
+
+// SetZebra sets the SGR escape sequences, such as "\x1b[48;5;236m", with
+// which the even and odd rows of the grid are written, counting rows from 0.
+// Each line of a row begins with the sequence and ends with a reset, and the
+// last column is padded so that the shading spans the whole grid. An empty
+// sequence leaves rows of that parity plain. Headers are not shaded. Zebra
+// striping applies to the Text and Table formats, and is off by default.
+// It is disabled when the NO_COLOR environment variable is set; see
+// SetForceColor.
+func (w *Writer) SetZebra(evenSGR, oddSGR string) {
+	w.zebra = [2]string{evenSGR, oddSGR}
+}
+
+// SetForceColor controls whether color options such as SetZebra take effect
+// even when the NO_COLOR environment variable is set to a non-empty value.
+// By default NO_COLOR is honored and the output is plain text.
+func (w *Writer) SetForceColor(on bool) {
+	w.forced = on
+}
+
+// colored reports whether escape sequences may be added to the output.
+func (w *Writer) colored() bool {
+	return w.forced || os.Getenv("NO_COLOR") == ""
+}
+
+// stripe returns the SGR sequence for row i of the grid.
+func (w *Writer) stripe(i int) string {
+	if !w.colored() {
+		return ""
 	}
+	return w.zebra[i%2]
+}
+
+// SetHeader controls whether the first line of input is used as a header.
+// The header is written above each column of the first grid, followed by a
+// rule, and counts toward the width of each of its columns. If the first grid
+// is not packed into columns, as when it is a word too wide to share its row,
+// the header and its rule are written once, on lines of their own. Later
+// grids have no header. It is not sorted, truncated or otherwise
+// filtered with the rest of the input, and words that would be joined by
+// SetSingleLineWhenFits are arranged into columns beneath it instead. It
+// applies to the Text and Table formats; in the others, and when the first
+// line is a row of fields, which stays the first row of its table, the first
+// line is treated like any other. It is off by default.
+func (w *Writer) SetHeader(on bool) {
+	w.headers = on
+}
+
+// SetHeaderRepeat causes the header to be written again before every n rows
+// of the first grid. If n is 0, the header is written only at the top.
+func (w *Writer) SetHeaderRepeat(n int) {
+	w.hrepeat = n
+}
+
+// SetNumbered controls whether each word is prefixed with its 1-based
+// position, right-aligned to the width of the largest number. Numbers follow
+// the fill order, so they read in sequence down the columns, or across the
+// rows with RowMajor. Spanning lines, as set by SetSpanningLines, and the
+// blank lines between groups of SetGroupOnBlank are not numbered. It is off
+// by default.
+func (w *Writer) SetNumbered(on bool) {
+	w.numbered = on
+}
+
+// SetBalanced controls whether ColumnMajor order balances the heights of the
+// columns, as described for ColumnMajor. If it is off, each column but the
+// last holds as many words as there are rows, which is n/c rounded up for n
+// words in c columns, and the last column holds the rest: 7 words in 3
+// columns are held 3, 3 and 1. Fewer columns than were chosen may then be
+// needed, and the extra ones are left off. It has no effect on RowMajor
+// order, and is on by default.
+func (w *Writer) SetBalanced(on bool) {
+	w.balanced = on
+}
+
+// SetOrder sets the order in which words are assigned to columns.
+func (w *Writer) SetOrder(order Order) {
+	w.order = order
+}
+
+// SetTabWidth sets the distance between tab stops used to expand tabs in the
+// input. The default is 8. If n is 0 or less, tabs are not expanded and are
+// measured like any other character.
+func (w *Writer) SetTabWidth(n int) {
+	w.tabwidth = n
 }
 
 // Write writes p to an internal buffer. No writes are done to the backing io.Writer
-// until Flush is called.
+// until Flush is called, unless automatic flushing is enabled with
+// SetAutoFlushLines, in which case Write reports any error from the flush.
 func (w *Writer) Write(p []byte) (n int, err error) {
-	return w.buf.Write(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	old := w.buf.Len()
+	w.buf.Write(p)
+	return len(p), w.autoFlush(old)
+}
+
+// WriteString is like Write, but writes the contents of s.
+func (w *Writer) WriteString(s string) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	old := w.buf.Len()
+	w.buf.WriteString(s)
+	return len(s), w.autoFlush(old)
+}
+
+// WriteByte is like Write, but writes the single byte c.
+func (w *Writer) WriteByte(c byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	old := w.buf.Len()
+	w.buf.WriteByte(c)
+	return w.autoFlush(old)
+}
+
+// WriteRune is like Write, but writes the UTF-8 encoding of r.
+func (w *Writer) WriteRune(r rune) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	old := w.buf.Len()
+	n, _ = w.buf.WriteRune(r)
+	return n, w.autoFlush(old)
+}
+
+// ReadFrom reads from r until EOF or error, appending the data to the
+// internal buffer. It returns the number of bytes read and any error other
+// than io.EOF. Data read before an error remains buffered. If automatic
+// flushing is enabled, r is read in pieces, so that the output keeps pace
+// with the input.
+func (w *Writer) ReadFrom(r io.Reader) (n int64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.autoflush <= 0 {
+		return w.buf.ReadFrom(r)
+	}
+	const chunk = 32 << 10
+	for {
+		old := w.buf.Len()
+		m, err := w.buf.ReadFrom(io.LimitReader(r, chunk))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if err := w.autoFlush(old); err != nil {
+			return n, err
+		}
+		if m < chunk {
+			return n, nil // r is at EOF
+		}
+	}
+}
+
+// autoFlush flushes the complete lines in the buffer, if there are as many
+// as set by SetAutoFlushLines. old is the length of the buffer before the
+// latest write. The caller must hold w.mu.
+func (w *Writer) autoFlush(old int) error {
+	if w.autoflush <= 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	sep := []byte(w.recsep)
+
+	// a separator may straddle the end of the old data
+	from := old - len(sep) + 1
+	if from < 0 {
+		from = 0
+	}
+	w.nlines += bytes.Count(data[from:], sep)
+	if w.nlines < w.autoflush {
+		return nil
+	}
+
+	// keep any partial line for the next batch
+	end := bytes.LastIndex(data, sep) + len(sep)
+	rest := append([]byte(nil), data[end:]...)
+	w.buf.Truncate(end)
+	_, _, err := w.flush(w.w)
+	w.buf.Write(rest)
+	if err != nil {
+		return err
+	}
+	w.nlines = 0
+	w.kept = w.printsHeader() // for the batches to come
+	return nil
 }
 
 type column struct {
 	words []string
+	width int
+	align Align
+	point int // offset of the decimal point, if align is DecimalAlign
+}
+
+// A grid is a set of columns written together.
+type grid struct {
+	cols []column
+	kind gridKind
 }
 
+// A gridKind describes how the words of a grid are arranged.
+type gridKind int
+
+const (
+	packed gridKind = iota // packed into as many columns as fit
+	fields                 // rows of delimited fields
+	wide                   // a single word too wide to share its row
+	blank                  // a blank line between groups
+	joined                 // words that fit on a single line
+	banner                 // a line written across the whole grid
+)
+
 // Flush performs the columnation and writes the results to the column.Writer's
-// backing io.Writer.
+// backing io.Writer. If the write succeeds, the buffered input is discarded so
+// that the Writer can be reused for the next block of input. If there are no
+// words to columnate, as when nothing has been written or every line has been
+// skipped, nothing is written, in any format.
+//
+// A word too wide for the Writer's width is written on a row of its own, and
+// the words before and after it are arranged into columns separately.
 func (w *Writer) Flush() error {
-	words := strings.Split(w.buf.String(), "\n")
-	w.colwidth = maxlen(words)
-	cols := make([]column, 1)
-	cols[0].words = words
-	for w.split(words, &cols) {
+	_, err := w.FlushSize()
+	return err
+}
+
+// A Size describes the dimensions of a columnated grid.
+type Size struct {
+	Columns int
+	Rows    int
+}
+
+// FlushSize is like Flush, but also reports the dimensions of the grid that
+// was written. Empty input produces a grid of size zero. If the input was
+// written as several grids, as with SetFieldDelimiter, Rows is their total
+// and Columns is the most of any of them.
+func (w *Writer) FlushSize() (Size, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	size, _, err := w.flush(w.w)
+	return size, err
+}
+
+// FlushReader is like Flush, but columnates the lines read from r until
+// io.EOF, after any buffered input, without first copying them into the
+// buffer. If reading from r fails, nothing is written, the buffered input is
+// kept, and the error is returned as a *ReadError.
+func (w *Writer) FlushReader(r io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.src = r
+	defer func() { w.src = nil }()
+	_, _, err := w.flush(w.w)
+	return err
+}
+
+// FlushTo is like Flush, but writes the grid to dst instead of the backing
+// io.Writer, which remains the destination of later calls to Flush. Unlike
+// Flush, it keeps the buffered input, so that the same input can be written
+// to several destinations, perhaps with a different width set for each. A
+// Flush or Reset discards it once it is no longer needed.
+func (w *Writer) FlushTo(dst io.Writer) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.in != nil {
+		if _, err := w.buf.ReadFrom(w.in); err != nil {
+			return &ReadError{Err: err}
+		}
+	}
+	size, _, err := w.render(dst)
+	if err != nil {
+		return err
 	}
-	return w.print(cols)
+	w.ncols = size.Columns
+	return nil
+}
+
+// FlushN is like Flush, but also reports the number of bytes written to the
+// backing io.Writer, including any written before an error.
+func (w *Writer) FlushN() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, n, err := w.flush(w.w)
+	return n, err
 }
 
-// maxlen returns the maximum length, in runes, of the strings in words
-func maxlen(words []string) int {
-	var max int
-	for i := range words {
-		l := len([]rune(words[i]))
-		if l > max {
-			max = l
+// flush implements the Flush methods, writing to dst; the caller must hold
+// w.mu.
+func (w *Writer) flush(dst io.Writer) (Size, int, error) {
+	if w.in != nil {
+		src := w.src
+		w.src = w.in
+		if src != nil {
+			w.src = io.MultiReader(w.in, src)
 		}
+		defer func() { w.src = src }()
 	}
-	return max
+	size, n, err := w.render(dst)
+	if err != nil {
+		return Size{}, n, err
+	}
+	w.buf.Reset()
+	w.nlines = 0
+	w.ncols = size.Columns
+	w.kept = false
+	return size, n, nil
+}
+
+// LastColumns returns the number of columns in the grid written by the most
+// recent successful Flush, or 0 if there has been none since the Writer was
+// created or Reset.
+func (w *Writer) LastColumns() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ncols
 }
 
-// split returns true if the split was successful, or false if cols is already
-// maximally columnated.
-func (w *Writer) split(words []string, cols *[]column) bool {
-	// try to become one column wider
-	newcols := make([]column, len(*cols)+1)
-	percol := len(words) / len(newcols)
-	if len(words)%len(newcols) != 0 {
-		percol++
+// render writes the grid for the buffered input to dst, reporting its size
+// and the number of bytes written. The caller must hold w.mu.
+func (w *Writer) render(dst io.Writer) (Size, int, error) {
+	cw := &countWriter{w: dst}
+	w.out = cw
+	var lw *lineWriter
+	if w.eol != "\n" || !w.trailing {
+		lw = &lineWriter{w: cw, eol: w.eol}
+		w.out = lw
+	}
+	if w.trimtrail && !w.padlast && w.rowtmpl == nil && (w.format == Text || w.format == Table) {
+		w.out = &trimWriter{w: w.out}
 	}
-	for colnum := range newcols {
-		i, j := percol*colnum, percol*colnum+percol
-		if j > len(words) {
-			j = len(words)
+	var size Size
+	grids, err := w.columnate()
+	if err != nil {
+		return Size{}, 0, err
+	}
+	grids, hidden := w.limit(grids)
+	whole := w.whole()
+	for _, g := range grids {
+		if !whole {
+			if err := w.print(g); err != nil {
+				return Size{}, cw.n, offset(err, size.Rows)
+			}
 		}
-
-		// empty columns are possible, bail out if we've reached one.
-		// otherwise, slice out some words for the column.
-		if i < len(words) {
-			colwords := words[i:j]
-			newcols[colnum] = column{words: colwords}
-		} else {
-			break
+		s := gridSize(g.cols)
+		size.Rows += s.Rows
+		if s.Columns > size.Columns {
+			size.Columns = s.Columns
 		}
 	}
-
-	// if newcols is too wide, discard it and stop
-	if w.totalwidth(newcols) >= w.maxwidth {
-		return false
+	if whole {
+		if err := w.printGrids(grids); err != nil {
+			return Size{}, cw.n, err
+		}
 	}
+	if hidden > 0 && w.rowtmpl == nil && (w.format == Text || w.format == Table) {
+		if _, err := fmt.Fprintf(w.out, w.overflow+"\n", hidden); err != nil {
+			return Size{}, cw.n, &WriteError{Row: size.Rows, Err: err}
+		}
+	}
+	if lw != nil && w.trailing {
+		if err := lw.end(); err != nil {
+			return Size{}, cw.n, err
+		}
+	}
+	return size, cw.n, nil
+}
 
-	// otherwise, tell the caller to continue splitting
-	*cols = newcols
-	return true
+// Layout returns the grid that Flush would write for the buffered input, as
+// rows of cells. Rows at the bottom of a ragged grid have fewer cells than
+// the others. Layout neither writes to the backing io.Writer nor discards the
+// buffered input.
+func (w *Writer) Layout() [][]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var cells [][]string
+	grids, _ := w.columnate() // reading from memory cannot fail
+	grids, _ = w.limit(grids)
+	for _, g := range grids {
+		cells = append(cells, rows(g.cols)...)
+	}
+	return cells
 }
 
-// totalwidth returns the total width of cols.
-func (w *Writer) totalwidth(cols []column) int {
-	width := (w.colwidth + 1) * (len(cols) - 1)
-	var lastwidth int
-	for _, word := range cols[len(cols)-1].words {
-		if len(word) > lastwidth {
-			lastwidth = len(word)
+// limit cuts grids short after the number of rows set by SetMaxRows, and
+// reports how many words were left off, counting each row of fields as one.
+func (w *Writer) limit(grids []grid) ([]grid, int) {
+	if w.maxrows <= 0 {
+		return grids, 0
+	}
+	left := w.maxrows
+	for i, g := range grids {
+		if rows := gridSize(g.cols).Rows; rows <= left {
+			left -= rows
+			continue
 		}
+		hidden := hiddenWords(g, left)
+		for j, col := range g.cols {
+			if len(col.words) > left {
+				g.cols[j].words = col.words[:left]
+			}
+		}
+		for _, g := range grids[i+1:] {
+			hidden += hiddenWords(g, 0)
+		}
+		if left == 0 {
+			return grids[:i], hidden
+		}
+		return grids[:i+1], hidden
 	}
-	return width + lastwidth
+	return grids, 0
 }
 
-// print writes the columns to the backing io.Writer.
-func (w *Writer) print(cols []column) error {
-	rowc := len(cols[0].words)
-	for i := 0; i < rowc; i++ {
-		for j := range cols {
-			if i >= len(cols[j].words) {
-				break // done this row
-			}
-			if j < len(cols)-1 {
-				_, err := fmt.Fprintf(w.w, "%-*s", w.colwidth+1, cols[j].words[i])
-				if err != nil {
-					return err
-				}
-			} else {
-				_, err := fmt.Fprintf(w.w, "%s", cols[j].words[i])
-				if err != nil {
-					return err
-				}
-			}
+// hiddenWords returns the number of words of g left off when it is cut short
+// after the given number of rows. A row of fields was a single line of input,
+// so it counts as one word however many fields it has.
+func hiddenWords(g grid, rows int) int {
+	switch g.kind {
+	case blank:
+		return 0
+	case fields:
+		if n := gridSize(g.cols).Rows - rows; n > 0 {
+			return n
 		}
-		_, err := fmt.Fprintln(w.w)
-		if err != nil {
-			return err
+		return 0
+	}
+	var n int
+	for _, col := range g.cols {
+		if len(col.words) > rows {
+			n += len(col.words) - rows
 		}
 	}
-	return nil
+	return n
+}
+
+// FitColumns reports how many columns Flush would use for the buffered input
+// if the Writer's width were width, without writing anything or changing the
+// width. If the input would be written as several grids, it reports the most
+// columns of any of them.
+func (w *Writer) FitColumns(width int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	maxwidth, autowidth := w.maxwidth, w.autowidth
+	w.maxwidth, w.autowidth = width, false
+	defer func() { w.maxwidth, w.autowidth = maxwidth, autowidth }()
+
+	var n int
+	grids, _ := w.columnate() // reading from memory cannot fail
+	for _, g := range grids {
+		if len(g.cols) > n {
+			n = len(g.cols)
+		}
+	}
+	return n
+}
+
+// RowsFor reports how many rows Flush would write for the buffered input if
+// it were arranged in n columns, as with SetColumns(n), without writing
+// anything or changing the Writer's settings. With either order, and whether
+// or not the columns are balanced, n columns of words hold the words in the
+// number of words divided by n rows, rounded up. Grids that are not arranged
+// into columns, such as those set apart by SetGroupOnBlank, count their own
+// rows, and the limit set by SetMaxRows applies. Headers are not counted. If
+// n is 0, the number of columns is chosen as by Flush.
+func (w *Writer) RowsFor(n int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n > 0 {
+		columns := w.columns
+		w.columns = n
+		defer func() { w.columns = columns }()
+	}
+
+	grids, _ := w.columnate() // reading from memory cannot fail
+	grids, _ = w.limit(grids)
+	var rows int
+	for _, g := range grids {
+		rows += gridSize(g.cols).Rows
+	}
+	return rows
+}
+
+// Fits reports whether every line that Flush would write for the buffered
+// input, in the Text or Table format, is no wider than the Writer's width.
+// It is false when a word is too wide for the width even on a row of its
+// own, or when SetColumns, SetMinColumns or delimited fields demand more
+// columns than fit; Flush still writes such lines in full. Callers can check
+// it before flushing to truncate, wrap or widen instead. It is always true if
+// the width is unlimited, and it neither writes anything nor discards the
+// buffered input.
+func (w *Writer) Fits() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	grids, _ := w.columnate() // reading from memory cannot fail
+	if w.maxwidth <= 0 {
+		return true
+	}
+	grids, _ = w.limit(grids)
+	for _, g := range grids {
+		var width int
+		switch g.kind {
+		case blank:
+			continue
+		case joined, banner:
+			width = w.joinedwidth(g.cols)
+		default:
+			width = w.gridwidth(g.cols, w.seps(g.cols))
+		}
+		if width > w.maxwidth {
+			return false
+		}
+	}
+	return true
+}
+
+// columnate arranges the buffered input into grids of columns. It fails only
+// if reading the input from w.src fails.
+func (w *Writer) columnate() ([]grid, error) {
+	if w.autowidth {
+		w.maxwidth = termWidth(w.w)
+	}
+	w.colbuf, w.fillbuf = w.colbuf[:0], w.fillbuf[:0]
+	words, err := w.words()
+	if err != nil {
+		return nil, err
+	}
+	// the header is not subject to the filters
+	w.titled = !w.kept // there is a header only if one is kept or taken
+	if !w.kept {
+		w.header = ""
+		if w.printsHeader() && len(words) > 0 && !w.delimited(words[0]) {
+			w.header = words[0]
+			words = words[1:]
+			w.titled = false
+		}
+	}
+	w.hwidth = w.cellwidth(w.header)
+	words = w.filter(words)
+	if w.numbered {
+		w.number(words)
+	}
+	widths := w.measure(words)
+
+	// split the input wherever the kind of grid changes
+	var grids []grid
+	for len(words) > 0 {
+		kind := w.kind(words[0], widths[0])
+		n := 1
+		for kind != wide && kind != blank && kind != banner && n < len(words) && w.kind(words[n], widths[n]) == kind {
+			n++
+		}
+		g := grid{kind: kind}
+		switch {
+		case kind == fields:
+			g.cols = w.table(words[:n])
+		case kind == banner:
+			g.cols = w.fill(words[:n], widths[:n], n)
+		case kind == packed && w.fitsLine(widths[:n]):
+			g.kind = joined
+			g.cols = w.fill(words[:n], widths[:n], n)
+		default:
+			g.cols = w.layout(words[:n], widths[:n])
+		}
+		grids = append(grids, g)
+		words, widths = words[n:], widths[n:]
+		w.hwidth = 0 // only the first grid is written beneath the header
+	}
+	return grids, nil
+}
+
+// fitsLine reports whether words of the given widths should be joined on a
+// single line, as set by SetSingleLineWhenFits.
+func (w *Writer) fitsLine(widths []int) bool {
+	if !w.oneline || w.format != Text || w.rtl || w.maxwidth <= 0 || w.printsHeader() {
+		return false
+	}
+	total := w.strwidth(w.separator()) * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+		if total >= w.maxwidth {
+			return false
+		}
+	}
+	return true
+}
+
+// kind returns the kind of grid that word, of the given width, belongs in.
+// A word too wide for the width is written on a row of its own, so that it
+// does not force the words around it into a single column. A minimum or
+// exact number of columns takes precedence.
+func (w *Writer) kind(word string, width int) gridKind {
+	switch {
+	case w.spans != nil && w.spans(word):
+		return banner
+	case w.grouping && strings.TrimSpace(word) == "":
+		return blank
+	case w.delimited(word):
+		return fields
+	case w.maxwidth > 0 && w.mincols <= 1 && w.columns == 0 && width+w.borderwidth() >= w.maxwidth:
+		return wide
+	}
+	return packed
+}
+
+// delimited reports whether line is a row of fields.
+func (w *Writer) delimited(line string) bool {
+	return w.fieldrows || w.fieldsep != "" && strings.Contains(line, w.fieldsep)
+}
+
+// splitFields splits a delimited line into its fields.
+func (w *Writer) splitFields(line string) []string {
+	if w.fieldsep == "" {
+		return strings.Fields(line)
+	}
+	return strings.Split(line, w.fieldsep)
+}
+
+// table arranges delimited lines into a column for each field. Missing fields
+// at the end of short rows are left empty.
+func (w *Writer) table(lines []string) []column {
+	var cols []column
+	for i, line := range lines {
+		for j, field := range w.splitFields(line) {
+			if j == len(cols) {
+				cols = append(cols, column{words: make([]string, len(lines)), width: w.mincell})
+			}
+			if w.maxcell > 0 && !w.wrap {
+				field = w.truncate(field, w.maxcell)
+			}
+			cols[j].words[i] = field
+			if cw := w.cellwidth(field); cw > cols[j].width {
+				cols[j].width = cw
+			}
+		}
+	}
+	w.setWidths(cols)
+	w.setAligns(cols)
+	return cols
+}
+
+// number prefixes each word with its 1-based index among the words that are
+// numbered. Spanning lines, and the blank lines between groups, are left as
+// they are, and are not counted.
+func (w *Writer) number(words []string) {
+	var count int
+	for _, word := range words {
+		if w.numberable(word) {
+			count++
+		}
+	}
+	n := len(strconv.Itoa(count))
+	var i int
+	for j, word := range words {
+		if w.numberable(word) {
+			i++
+			words[j] = fmt.Sprintf("%*d %s", n, i, word)
+		}
+	}
+}
+
+// numberable reports whether word is given a number by SetNumbered.
+func (w *Writer) numberable(word string) bool {
+	if w.grouping && strings.TrimSpace(word) == "" {
+		return false
+	}
+	return w.spans == nil || !w.spans(word)
+}
+
+// layout arranges words into as many columns as the Writer's settings allow.
+// Trailing empty columns are removed from the result.
+func (w *Writer) layout(words []string, widths []int) []column {
+	if w.decimalAligned() {
+		// the columns aligned on decimal points are measured by their parts
+		ints := w.intbuf[:0]
+		for _, word := range words {
+			ints = append(ints, w.intwidth(word))
+		}
+		w.intbuf, w.ints = ints, ints
+		defer func() { w.ints = nil }()
+	}
+	n := w.columns
+	if n <= 0 {
+		n = w.fits(widths)
+		for w.split(widths, n) {
+			n++
+		}
+		if n < w.mincols && len(words) >= w.mincols {
+			n = w.mincols
+		}
+	}
+	cols := w.fill(words, widths, n)
+	for len(cols) > 0 && len(cols[len(cols)-1].words) == 0 {
+		cols = cols[:len(cols)-1]
+	}
+	if w.rtl {
+		for i, j := 0, len(cols)-1; i < j; i, j = i+1, j-1 {
+			cols[i], cols[j] = cols[j], cols[i]
+		}
+	}
+	w.setWidths(cols)
+	w.setAligns(cols)
+	return cols
+}
+
+// setWidths gives each of cols the width set for it with SetColumnWidths,
+// truncating its words to fit unless they may overflow.
+func (w *Writer) setWidths(cols []column) {
+	for i := range cols {
+		if i >= len(w.colwidths) || w.colwidths[i] <= 0 {
+			continue
+		}
+		cols[i].width = w.colwidths[i]
+		if w.spill {
+			continue
+		}
+		for j, word := range cols[i].words {
+			cols[i].words[j] = w.truncate(word, cols[i].width)
+		}
+	}
+}
+
+// minwidth returns the width below which no column may be narrowed.
+func (w *Writer) minwidth() int {
+	if w.mincell > w.hwidth {
+		return w.mincell
+	}
+	return w.hwidth
+}
+
+// setAligns sets the alignment of each of cols.
+func (w *Writer) setAligns(cols []column) {
+	for i := range cols {
+		cols[i].align = w.align
+		if w.autoalign && numeric(cols[i].words) {
+			cols[i].align = Right
+		}
+		if i < len(w.colaligns) {
+			cols[i].align = w.colaligns[i]
+		}
+		if cols[i].align == DecimalAlign {
+			w.setPoint(&cols[i])
+		}
+	}
+}
+
+// setPoint finds where the decimal points of col's words line up, widening
+// the column if their integer and fractional parts do not otherwise fit.
+func (w *Writer) setPoint(col *column) {
+	var point, frac int
+	for _, word := range col.words {
+		n := w.intwidth(word)
+		if n > point {
+			point = n
+		}
+		if f := w.strwidth(word) - n; f > frac {
+			frac = f
+		}
+	}
+	col.point = point
+	if point+frac > col.width {
+		col.width = point + frac
+	}
+}
+
+// intwidth returns the width of the integer part of word, which is all of it
+// if it has no decimal point.
+func (w *Writer) intwidth(word string) int {
+	if i := strings.IndexByte(word, '.'); i >= 0 {
+		word = word[:i]
+	}
+	return w.strwidth(word)
+}
+
+// numeric reports whether every one of words is a number.
+func numeric(words []string) bool {
+	for _, word := range words {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(word), 64); err != nil {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// gridSize returns the dimensions of cols.
+func gridSize(cols []column) Size {
+	size := Size{Columns: len(cols)}
+	for _, col := range cols {
+		if len(col.words) > size.Rows {
+			size.Rows = len(col.words)
+		}
+	}
+	return size
+}
+
+// Close flushes any buffered input. It does not close the backing io.Writer.
+// After Close, Write returns ErrClosed; calling Close again has no effect.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if _, _, err := w.flush(w.w); err != nil {
+		return err
+	}
+	w.closed = true
+	return nil
+}
+
+// Reset discards any buffered input without writing it, and clears the
+// count reported by LastColumns.
+func (w *Writer) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset()
+	w.nlines = 0
+	w.ncols = 0
+	w.kept = false
+}
+
+// words splits the buffered input, followed by anything read from w.src, into
+// the words to be columnated, before they are filtered. The input is scanned a
+// line at a time, so that only one copy of it is made.
+func (w *Writer) words() ([]string, error) {
+	data := w.buf.Bytes()
+	words := w.wordbuf[:0]
+	if n := bytes.Count(data, []byte(w.recsep)) + 1; cap(words) < n {
+		words = make([]string, 0, n)
+	}
+
+	// bufio.ScanLines strips carriage returns, and treats a final newline
+	// as terminating the last line rather than starting a new one. Reading
+	// from memory cannot fail, but a line may be as long as the input.
+	var r io.Reader = bytes.NewReader(data)
+	max := len(data) + 1
+	if w.src != nil {
+		r, max = io.MultiReader(r, w.src), math.MaxInt
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, max)
+	if w.recsep != "\n" {
+		sc.Split(scanRecords(w.recsep))
+	}
+	for sc.Scan() {
+		words = append(words, w.word(sc.Text()))
+	}
+	w.wordbuf = words
+	if err := sc.Err(); err != nil {
+		return nil, &ReadError{Err: err}
+	}
+	return words, nil
+}
+
+// scanRecords returns a bufio.SplitFunc that splits its input at each
+// occurrence of sep. Like bufio.ScanLines, it treats a final separator as
+// terminating the last record rather than starting a new one.
+func scanRecords(sep string) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, []byte(sep)); i >= 0 {
+			return i + len(sep), data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil // request more data
+	}
+}
+
+// word prepares a single line of input for measurement.
+func (w *Writer) word(s string) string {
+	if w.normalize {
+		s = w.normform.String(s)
+	}
+	if w.trim {
+		s = strings.TrimSpace(s)
+	}
+	if w.tabwidth > 0 && w.fieldsep != "" && w.delimited(s) {
+		// the delimiter may itself be a tab
+		fields := strings.Split(s, w.fieldsep)
+		for i := range fields {
+			fields[i] = w.expandTabs(fields[i])
+		}
+		s = strings.Join(fields, w.fieldsep)
+	} else if w.tabwidth > 0 {
+		s = w.expandTabs(s)
+	}
+	return s
+}
+
+// filter applies the Writer's settings to the list of words as a whole.
+func (w *Writer) filter(words []string) []string {
+	if w.skipblank {
+		words = skipBlank(words)
+	}
+	if w.unique {
+		words = uniq(words)
+	}
+	if w.sort {
+		w.sortWords(words)
+	}
+	if w.maxcell > 0 && !w.wrap {
+		for i := range words {
+			if !w.delimited(words[i]) && (w.spans == nil || !w.spans(words[i])) {
+				words[i] = w.truncate(words[i], w.maxcell)
+			}
+		}
+	}
+	return words
+}
+
+// skipBlank removes empty and all-whitespace strings from words in place.
+func skipBlank(words []string) []string {
+	out := words[:0]
+	for _, word := range words {
+		if strings.TrimSpace(word) != "" {
+			out = append(out, word)
+		}
+	}
+	return out
+}
+
+// uniq removes repeated strings from words in place, keeping the first
+// occurrence of each.
+func uniq(words []string) []string {
+	seen := make(map[string]bool, len(words))
+	out := words[:0]
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			out = append(out, word)
+		}
+	}
+	return out
+}
+
+// expandTabs replaces each tab in s with enough spaces to reach the next tab
+// stop, counting from the start of s.
+func (w *Writer) expandTabs(s string) string {
+	if !strings.ContainsRune(s, '\t') {
+		return s
+	}
+	var b strings.Builder
+	var col int
+	for len(s) > 0 {
+		if s[0] == '\t' {
+			n := w.tabwidth - col%w.tabwidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			s = s[1:]
+			continue
+		}
+		size, width := w.next(s)
+		b.WriteString(s[:size])
+		col += width
+		s = s[size:]
+	}
+	return b.String()
+}
+
+// ellipsis marks the end of a truncated word.
+const ellipsis = "…"
+
+// truncate shortens s to at most n cells by replacing its end with an
+// ellipsis. Escape sequences in the removed text are kept if the Writer is
+// ANSI-aware, so that attributes are still reset.
+func (w *Writer) truncate(s string, n int) string {
+	if w.strwidth(s) <= n {
+		return s
+	}
+	var b strings.Builder
+	var col int
+	cut := false
+	for len(s) > 0 {
+		size, width := w.next(s)
+		unit := s[:size]
+		s = s[size:]
+		switch {
+		case w.ansi && unit[0] == '\x1b':
+			b.WriteString(unit)
+		case cut:
+		case col+width > n-1:
+			b.WriteString(ellipsis)
+			cut = true
+		default:
+			b.WriteString(unit)
+			col += width
+		}
+	}
+	return b.String()
+}
+
+// wrapwidth returns the width at which words are wrapped, or 0 if words are
+// not wrapped.
+func (w *Writer) wrapwidth() int {
+	switch {
+	case !w.wrap:
+		return 0
+	case w.maxcell > 0:
+		return w.maxcell
+	case w.maxwidth > 0:
+		return w.maxwidth
+	}
+	return 0
+}
+
+// cellwidth returns the width of the cell needed to hold word. A wrapped word
+// needs the wrapping width, unless it has a unit too wide to be split, which
+// has a line of its own.
+func (w *Writer) cellwidth(word string) int {
+	n := w.strwidth(word)
+	limit := w.wrapwidth()
+	if limit <= 0 || n <= limit {
+		return n
+	}
+	n = limit
+	for s := word; len(s) > 0; {
+		size, cells := w.next(s)
+		if cells > n {
+			n = cells
+		}
+		s = s[size:]
+	}
+	return n
+}
+
+// lines returns the lines of the cell holding word.
+func (w *Writer) lines(lines []string, word string) []string {
+	limit := w.wrapwidth()
+	if limit <= 0 {
+		return append(lines, word)
+	}
+	for w.strwidth(word) > limit {
+		i := w.cut(word, limit)
+		if i == len(word) {
+			break // a single unit wider than the limit
+		}
+		if word[i] == ' ' {
+			lines = append(lines, word[:i])
+			word = word[i+1:]
+		} else if j := strings.LastIndexByte(word[:i], ' '); j > 0 {
+			lines = append(lines, word[:j])
+			word = word[j+1:]
+		} else {
+			lines = append(lines, word[:i])
+			word = word[i:]
+		}
+	}
+	return append(lines, word)
+}
+
+// cut returns the length in bytes of the longest prefix of s that is at most
+// n cells wide. The prefix contains at least one rune, so that progress is
+// always made.
+func (w *Writer) cut(s string, n int) int {
+	var i, col int
+	for i < len(s) {
+		size, width := w.next(s[i:])
+		if col+width > n && col > 0 {
+			break
+		}
+		col += width
+		i += size
+	}
+	return i
+}
+
+// parallelWords is the number of words from which measure divides the work
+// among several goroutines. For fewer, starting them costs more than it
+// saves.
+const parallelWords = 1 << 15
+
+// measure returns the cell width of each of words. A large input is measured
+// in chunks, one for each of up to GOMAXPROCS goroutines, unless the width is
+// measured by a function set with SetWidthFunc, which need not be safe for
+// concurrent use.
+func (w *Writer) measure(words []string) []int {
+	widths := w.widthbuf[:0]
+	if cap(widths) < len(words) {
+		widths = make([]int, len(words))
+	}
+	widths = widths[:len(words)]
+	w.widthbuf = widths
+
+	procs := runtime.GOMAXPROCS(0)
+	if len(words) < parallelWords || procs < 2 || w.widthfunc != nil {
+		w.measureInto(widths, words)
+		return widths
+	}
+	chunk := (len(words) + procs - 1) / procs
+	var wg sync.WaitGroup
+	for i := 0; i < len(words); i += chunk {
+		end := i + chunk
+		if end > len(words) {
+			end = len(words)
+		}
+		wg.Add(1)
+		go func(widths []int, words []string) {
+			defer wg.Done()
+			w.measureInto(widths, words)
+		}(widths[i:end], words[i:end])
+	}
+	wg.Wait()
+	return widths
+}
+
+// measureInto stores the cell width of each of words in widths.
+func (w *Writer) measureInto(widths []int, words []string) {
+	for i, word := range words {
+		widths[i] = w.cellwidth(word)
+	}
+}
+
+// fits returns a number of columns, at least 1, into which words of the given
+// widths are sure to fit, as would any smaller number, without measuring the
+// columns. It lets the search for the most columns that fit start from there.
+// The width of a layout does not always grow with its number of columns, so
+// the search cannot skip ahead any further than this without risking a
+// different result.
+func (w *Writer) fits(widths []int) int {
+	if w.maxwidth <= 0 || len(widths) == 0 {
+		return 1
+	}
+	widest := w.minwidth()
+	var point, frac int
+	for i, width := range widths {
+		if width > widest {
+			widest = width
+		}
+		if w.ints != nil {
+			if w.ints[i] > point {
+				point = w.ints[i]
+			}
+			if f := width - w.ints[i]; f > frac {
+				frac = f
+			}
+		}
+	}
+	if point+frac > widest {
+		widest = point + frac
+	}
+	// no column is wider than the widest word, or than the widest parts of
+	// words aligned on decimal points
+	per, sep := widest+w.lpad+w.rpad, w.strwidth(w.separator())
+	if w.proportional() {
+		sep = w.gap(widest)
+	}
+	room := w.maxwidth - w.borderwidth() - 1 + sep
+	n := len(widths)
+	if per+sep > 0 && room/(per+sep) < n {
+		n = room / (per + sep)
+	}
+	if w.maxcols > 0 && n > w.maxcols {
+		n = w.maxcols
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// split reports whether words of the given widths, arranged in n columns,
+// can be split into n+1 columns.
+func (w *Writer) split(widths []int, n int) bool {
+	// more columns than words would only add empty ones
+	if n >= len(widths) {
+		return false
+	}
+	if w.maxwidth <= 0 {
+		return false
+	}
+	if w.maxcols > 0 && n >= w.maxcols {
+		return false
+	}
+	return w.totalwidth(widths, n+1) < w.maxwidth
+}
+
+// fill distributes words among n columns according to the Writer's order,
+// and sizes the resulting columns using the words' widths.
+func (w *Writer) fill(words []string, widths []int, n int) []column {
+	start := len(w.colbuf)
+	for i := 0; i < n; i++ {
+		w.colbuf = append(w.colbuf, column{})
+	}
+	newcols := w.colbuf[start:]
+	if w.order == RowMajor {
+		w.fillRows(words, newcols)
+	} else {
+		w.fillColumns(words, newcols)
+	}
+	for i := range newcols {
+		newcols[i].width = w.colwidth(widths, n, i)
+	}
+	return newcols
+}
+
+// fillRows deals words out to the columns in turn. The columns share storage
+// sized to hold all the words, so that they need not grow one by one.
+func (w *Writer) fillRows(words []string, newcols []column) {
+	n := len(newcols)
+	start := len(w.fillbuf)
+	w.fillbuf = append(w.fillbuf, words...)
+	buf := w.fillbuf[start:]
+	for c := range newcols {
+		m := (len(words) - c + n - 1) / n // words in column c
+		if m <= 0 {
+			break
+		}
+		col := buf[:m:m]
+		for r := range col {
+			col[r] = words[c+r*n]
+		}
+		newcols[c].words = col
+		buf = buf[m:]
+	}
+}
+
+// fillColumns slices words into consecutive runs, one per column.
+func (w *Writer) fillColumns(words []string, newcols []column) {
+	for c := range newcols {
+		i, j := w.span(len(words), len(newcols), c)
+		if i == j {
+			break // fewer words than columns
+		}
+		newcols[c] = column{words: words[i:j]}
+	}
+}
+
+// span returns the indexes bounding column c when count words are arranged in
+// n columns in ColumnMajor order.
+func (w *Writer) span(count, n, c int) (i, j int) {
+	if !w.balanced {
+		percol := (count + n - 1) / n
+		i, j = c*percol, c*percol+percol
+		if i > count {
+			i = count
+		}
+		if j > count {
+			j = count
+		}
+		return i, j
+	}
+	q, r := count/n, count%n
+	i = c * q
+	if c < r {
+		return i + c, i + c + q + 1
+	}
+	return i + r, i + r + q
+}
+
+// totalwidth returns the total width of words of the given widths arranged
+// in n columns. Columns are measured only until the total reaches the
+// Writer's width.
+func (w *Writer) totalwidth(widths []int, n int) int {
+	total := w.borderwidth()
+	if !w.proportional() {
+		total += w.strwidth(w.separator()) * (n - 1)
+	}
+	for c := 0; c < n && total < w.maxwidth; c++ {
+		cw := w.colwidth(widths, n, c)
+		if cw > 0 {
+			total += cw + w.lpad + w.rpad
+		}
+		if w.proportional() && c < n-1 {
+			total += w.gap(cw)
+		}
+	}
+	return total
+}
+
+// colwidth returns the width of column c when words of the given widths are
+// arranged in n columns. An empty column has no width. A column aligned on
+// decimal points is wide enough for its widest integer part and its widest
+// fractional part, as setPoint makes it.
+func (w *Writer) colwidth(widths []int, n, c int) int {
+	if c >= len(widths) {
+		return 0
+	}
+	i, j, step := c, len(widths), n
+	if w.order != RowMajor {
+		i, j = w.span(len(widths), n, c)
+		step = 1
+	}
+	decimal := w.ints != nil && w.decimal(len(widths), n, c)
+	max := w.minwidth()
+	var point, frac int
+	for ; i < j; i += step {
+		if widths[i] > max {
+			max = widths[i]
+		}
+		if decimal {
+			if w.ints[i] > point {
+				point = w.ints[i]
+			}
+			if f := widths[i] - w.ints[i]; f > frac {
+				frac = f
+			}
+		}
+	}
+	if point+frac > max {
+		max = point + frac
+	}
+	return max
+}
+
+// decimalAligned reports whether any column may be aligned on decimal points.
+func (w *Writer) decimalAligned() bool {
+	if w.align == DecimalAlign {
+		return true
+	}
+	for _, align := range w.colaligns {
+		if align == DecimalAlign {
+			return true
+		}
+	}
+	return false
+}
+
+// decimal reports whether column c is aligned on decimal points when count
+// words are arranged in n columns. Numeric columns that SetAutoAlign would
+// right-align instead are counted too, which errs on the side of fitting.
+func (w *Writer) decimal(count, n, c int) bool {
+	if w.rtl {
+		c = w.used(count, n) - 1 - c // the columns are reversed after filling
+	}
+	if c < 0 {
+		return false // an empty column, which is removed
+	}
+	if c < len(w.colaligns) {
+		return w.colaligns[c] == DecimalAlign
+	}
+	return w.align == DecimalAlign
+}
+
+// used returns the number of columns that hold words when count words are
+// arranged in n columns.
+func (w *Writer) used(count, n int) int {
+	if w.order == RowMajor {
+		if count < n {
+			return count
+		}
+		return n
+	}
+	for c := n; c > 0; c-- {
+		if i, j := w.span(count, n, c-1); i < j {
+			return c
+		}
+	}
+	return 0
+}
+
+// print writes the columns to the backing io.Writer.
+func (w *Writer) print(g grid) error {
+	cols := g.cols
+	if w.rowtmpl != nil {
+		return w.printTemplate(cols)
+	}
+	if w.format != Text && w.format != Table {
+		return w.printFormat(cols)
+	}
+	first := !w.titled
+	w.titled = true
+	if first && g.kind != packed {
+		if err := w.printLoneHeader(); err != nil {
+			return err
+		}
+		first = false
+	}
+	if g.kind == joined || g.kind == banner {
+		return w.printJoined(cols)
+	}
+	rowc := gridSize(cols).Rows
+	seps := w.seps(cols)
+	w.setIndent(w.gridwidth(cols, seps))
+	bordered := w.borderwidth() > 0
+	if bordered && rowc > 0 {
+		if err := w.printRule(cols, "┌", "┬", "┐"); err != nil {
+			return &WriteError{Err: err}
+		}
+	}
+	for i := 0; i < rowc; i++ {
+		if first && (i == 0 || w.hrepeat > 0 && i%w.hrepeat == 0) {
+			if err := w.printHeader(cols, seps); err != nil {
+				return offset(err, i)
+			}
+		}
+		cells, lines := w.cellbuf[:0], w.linebuf[:0]
+		for j := range cols {
+			if i >= len(cols[j].words) {
+				if !w.padLast() && !w.rtl {
+					break // done this row
+				}
+				cells = append(cells, nil)
+				continue
+			}
+			k := len(lines)
+			lines = w.lines(lines, cols[j].words[i])
+			cells = append(cells, lines[k:])
+		}
+		w.cellbuf, w.linebuf = cells, lines
+		if g.kind == fields && !w.padLast() {
+			// leave short rows short
+			for len(cells) > 1 && cols[len(cells)-1].words[i] == "" {
+				cells = cells[:len(cells)-1]
+			}
+		}
+		if err := w.printRow(cols, seps, cells, w.stripe(i)); err != nil {
+			return offset(err, i)
+		}
+	}
+	if bordered && rowc > 0 {
+		if err := w.printRule(cols, "└", "┴", "┘"); err != nil {
+			return &WriteError{Row: rowc - 1, Err: err}
+		}
+	}
+	return nil
+}
+
+// printJoined writes the words of single-word columns on one line.
+func (w *Writer) printJoined(cols []column) error {
+	w.setIndent(w.joinedwidth(cols))
+	out, offs := append(w.outbuf[:0], w.indent...), w.offbuf[:0]
+	for j, col := range cols {
+		offs = append(offs, len(out))
+		if j > 0 {
+			out = append(out, w.separator()...)
+		}
+		out = append(out, col.words[0]...)
+	}
+	out = append(out, '\n')
+	w.outbuf, w.offbuf = out, offs
+	if n, err := w.out.Write(out); err != nil {
+		return &WriteError{Column: cellAt(offs, n), Err: err}
+	}
+	return nil
+}
+
+// joinedwidth returns the width of the line written by printJoined.
+func (w *Writer) joinedwidth(cols []column) int {
+	width := w.strwidth(w.separator()) * (len(cols) - 1)
+	for _, col := range cols {
+		width += w.strwidth(col.words[0])
+	}
+	return width
+}
+
+// rulechar returns the string repeated to draw the rule beneath a header.
+func (w *Writer) rulechar() string {
+	if w.format == Table {
+		return "─"
+	}
+	return "-"
+}
+
+// printLoneHeader writes the header and its rule on lines of their own.
+func (w *Writer) printLoneHeader() error {
+	rule := strings.Repeat(w.rulechar(), w.strwidth(w.header))
+	if _, err := fmt.Fprintf(w.out, "%s\n%s\n", w.header, rule); err != nil {
+		return &WriteError{Err: err}
+	}
+	return nil
+}
+
+// printHeader writes the header above each column, followed by a rule.
+func (w *Writer) printHeader(cols []column, seps []string) error {
+	rulechar := w.rulechar()
+	cells := make([][]string, len(cols))
+	rule := make([][]string, len(cols))
+	for j, col := range cols {
+		cells[j] = w.lines(nil, w.header)
+		rule[j] = []string{strings.Repeat(rulechar, col.width)}
+	}
+	if err := w.printRow(cols, seps, cells, ""); err != nil {
+		return err
+	}
+	if w.borderwidth() > 0 {
+		if err := w.printRule(cols, "├", "┼", "┤"); err != nil {
+			return &WriteError{Err: err}
+		}
+		return nil
+	}
+	return w.printRow(cols, seps, rule, "")
+}
+
+// printRow writes one row of cells, each given as the lines it occupies.
+// A row is as tall as its tallest cell. If sgr is not empty, each line of the
+// row is written with those attributes. Each line is written to the backing
+// io.Writer in a single Write. Errors are reported as a *WriteError for row 0.
+func (w *Writer) printRow(cols []column, seps []string, cells [][]string, sgr string) error {
+	padlast := w.padLast()
+	bordered := w.borderwidth() > 0
+	var height int
+	for _, lines := range cells {
+		if len(lines) > height {
+			height = len(lines)
+		}
+	}
+
+	for k := 0; k < height; k++ {
+		// a short row ends at its last cell, with no separator after it, and
+		// continuation lines stop after their last non-empty cell
+		end := len(cells) - 1
+		if k > 0 && !padlast {
+			for end > 0 && k >= len(cells[end]) {
+				end--
+			}
+		}
+		out, offs := append(w.outbuf[:0], w.indent...), w.offbuf[:0]
+		out = append(out, sgr...)
+		if bordered {
+			out = append(out, "│ "...)
+		}
+		for j, lines := range cells[:end+1] {
+			offs = append(offs, len(out))
+			var line string
+			if k < len(lines) {
+				line = lines[k]
+			}
+			var sep string
+			lastcell := j == end
+			if !lastcell {
+				sep = seps[j]
+			}
+			trim := lastcell && !padlast
+			word, left, right := w.padded(line, cols[j].width, cols[j].align, trim)
+			if cols[j].align == DecimalAlign {
+				left, right = w.pointPadding(line, cols[j], trim)
+			}
+			inner := w.rpad
+			if trim {
+				inner = 0
+			}
+			var restore string
+			if sgr != "" && strings.Contains(word, "\x1b") {
+				restore = sgr // the word may have reset it
+			}
+			out = append(out, w.padding(w.lpad, "")...)
+			out = append(out, w.padding(left, word)...)
+			out = append(out, word...)
+			out = append(out, restore...)
+			out = append(out, w.padding(right, word)...)
+			out = append(out, w.padding(inner, "")...)
+			out = append(out, sep...)
+		}
+		if bordered {
+			out = append(out, " │"...)
+		}
+		if sgr != "" {
+			out = append(out, sgrReset...)
+		}
+		out = append(out, '\n')
+		w.outbuf, w.offbuf = out, offs
+		if n, err := w.out.Write(out); err != nil {
+			return &WriteError{Column: cellAt(offs, n), Err: err}
+		}
+	}
+	return nil
+}
+
+// cellAt returns the column of the cell to which byte n of a line belongs,
+// given the offset in the line at which each cell starts. Bytes before the
+// first cell belong to it, and those after the last cell to the last.
+func cellAt(offs []int, n int) int {
+	j := 0
+	for j+1 < len(offs) && offs[j+1] <= n {
+		j++
+	}
+	return j
+}
+
+// seps returns the separators to be written after each column of cols but
+// the last.
+func (w *Writer) seps(cols []column) []string {
+	if len(cols) < 2 {
+		return nil
+	}
+	sep := w.separator()
+	seps := make([]string, len(cols)-1)
+	for j := range seps {
+		seps[j] = sep
+		if w.proportional() {
+			seps[j] = w.padding(w.gap(cols[j].width), "")
+		}
+	}
+	if !w.justify && !w.flushlast {
+		return seps
+	}
+
+	extra := w.maxwidth - 1 - w.gridwidth(cols, seps)
+	if extra <= 0 {
+		return seps
+	}
+	if !w.justify {
+		seps[len(seps)-1] = strings.Repeat(" ", extra) + seps[len(seps)-1]
+		return seps
+	}
+	for j := range seps {
+		n := extra / len(seps)
+		if j < extra%len(seps) {
+			n++
+		}
+		seps[j] = strings.Repeat(" ", n) + seps[j]
+	}
+	return seps
+}
+
+// gridwidth returns the width of cols when separated by seps.
+func (w *Writer) gridwidth(cols []column, seps []string) int {
+	width := w.borderwidth()
+	for j := range seps {
+		width += w.strwidth(seps[j])
+	}
+	for _, col := range cols {
+		width += col.width + w.lpad + w.rpad
+	}
+	return width
+}
+
+// pad returns word padded to the given width according to align. Padding on
+// the right is omitted for the last column.
+func (w *Writer) pad(word string, width int, align Align, last bool) string {
+	word, left, right := w.padded(word, width, align, last)
+	return w.padding(left, word) + word + w.padding(right, word)
+}
+
+// padded is like pad, but returns the cells of padding needed on the left and
+// right of word instead of adding them.
+func (w *Writer) padded(word string, width int, align Align, last bool) (s string, left, right int) {
+	fill := width - w.strwidth(word)
+	if w.ansi {
+		word = closeSGR(word)
+	}
+	if fill <= 0 {
+		return word, 0, 0
+	}
+	switch align {
+	case Right, DecimalAlign:
+		left = fill
+	case Center:
+		left = fill / 2
+		right = fill - left
+	default:
+		right = fill
+	}
+	if last {
+		right = 0
+	}
+	return word, left, right
+}
+
+// pointPadding returns the cells of padding needed on the left and right of
+// word to line up its decimal point with the others in col.
+func (w *Writer) pointPadding(word string, col column, last bool) (left, right int) {
+	fill := col.width - w.strwidth(word)
+	if fill <= 0 {
+		return 0, 0
+	}
+	left = col.point - w.intwidth(word)
+	if left < 0 {
+		left = 0
+	} else if left > fill {
+		left = fill
+	}
+	if !last {
+		right = fill - left
+	}
+	return left, right
+}
+
+// blanks holds enough spaces for most padding.
+const blanks = "                                                                "
+
+// padding returns n cells of padding for word.
+func (w *Writer) padding(n int, word string) string {
+	if word == "" || w.padrune == ' ' {
+		if n <= len(blanks) {
+			return blanks[:n]
+		}
+		return strings.Repeat(" ", n)
+	}
+	// a wide pad rune may leave a cell that only a space can fill
+	rw := runewidth(w.padrune)
+	return strings.Repeat(string(w.padrune), n/rw) + strings.Repeat(" ", n%rw)
 }
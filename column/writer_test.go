@@ -0,0 +1,2486 @@
+package column
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+func columnate(t *testing.T, w *Writer, input string) {
+	if _, err := w.Write([]byte(input)); err != nil {
+		t.Fatalf("write %q: %v", input, err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush %q: %v", input, err)
+	}
+}
+
+func TestWideRunes(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  string
+	}{
+		{12, "日本\na\n中文字\nbb", "日本 中文字\na    bb\n"},
+		{11, "日本\na\n中文字\nbb", "日本\na\n中文字\nbb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		columnate(t, NewWriter(&buf, test.width), test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestANSIAware(t *testing.T) {
+	red := func(s string) string { return "\x1b[31m" + s + "\x1b[0m" }
+	tests := []struct {
+		ansi  bool
+		input string
+		want  string
+	}{
+		{true, red("aa") + "\nb\nc\n" + red("dd"), red("aa") + " c\nb  " + red("dd") + "\n"},
+		{false, red("aa") + "\nb\nc\n" + red("dd"), red("aa") + "\nb c\n" + red("dd") + "\n"},
+		{true, "aa\nbb\ncc\ndd\x1b[3", "aa cc\nbb dd\x1b[3\n"},
+		{true, "aa\nbb\ncc\ndd\x1b", "aa cc\nbb dd\x1b\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetANSIAware(test.ansi)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("ansi %v, input %q: got %q, want %q", test.ansi, test.input, got, test.want)
+		}
+	}
+}
+
+func TestMultibytePadding(t *testing.T) {
+	var buf bytes.Buffer
+	columnate(t, NewWriter(&buf, 12), "café\nnaïve\nab\nçà")
+	want := "café  ab çà\nnaïve\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		order Order
+		input string
+		want  string
+	}{
+		{ColumnMajor, "a\nb\nc\nd\ne", "a c e\nb d\n"},
+		{RowMajor, "a\nb\nc\nd\ne", "a b c\nd e\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetOrder(test.order)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("order %v, input %q: got %q, want %q", test.order, test.input, got, test.want)
+		}
+	}
+}
+
+func TestGap(t *testing.T) {
+	tests := []struct {
+		gap   int
+		width int
+		input string
+		want  string
+	}{
+		{1, 8, "a\nb\nc\nd", "a b c d\n"},
+		{3, 8, "a\nb\nc\nd", "a   c\nb   d\n"},
+		{3, 5, "a\nb\nc\nd", "a\nb\nc\nd\n"},
+		{-1, 3, "a\nb\nc\nd", "ac\nbd\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetGap(test.gap)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("gap %d, width %d, input %q: got %q, want %q", test.gap, test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestProportionalGap(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  string
+	}{
+		{0, "a\n", "a\n"},
+		{80, "aaaaaaaa\nb\nc\n", "aaaaaaaa  b c\n"},
+		{13, "aaaaaaaa\nb\nc\n", "aaaaaaaa  c\nb\n"},
+		{80, "aaaa\nbbbb\nc\n", "aaaa bbbb c\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetProportionalGap(0.25, 1)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+// TestFill pins down how words are assigned to the cells of the grid, which
+// must not change from one release to the next.
+func TestFill(t *testing.T) {
+	tests := []struct {
+		order    Order
+		balanced bool
+		n        int
+		input    string
+		want     [][]string
+	}{
+		{ColumnMajor, true, 3, "a\nb\nc\nd\ne\nf\ng\n", [][]string{{"a", "d", "f"}, {"b", "e", "g"}, {"c"}}},
+		{ColumnMajor, true, 3, "a\nb\nc\nd\n", [][]string{{"a", "c", "d"}, {"b"}}},
+		{ColumnMajor, true, 4, "a\nb\nc\nd\ne\nf\n", [][]string{{"a", "c", "e", "f"}, {"b", "d"}}},
+		{ColumnMajor, true, 3, "a\nb\n", [][]string{{"a", "b"}}},
+		{ColumnMajor, false, 3, "a\nb\nc\nd\ne\nf\ng\n", [][]string{{"a", "d", "g"}, {"b", "e"}, {"c", "f"}}},
+		{ColumnMajor, false, 3, "a\nb\nc\nd\n", [][]string{{"a", "c"}, {"b", "d"}}},
+		{ColumnMajor, false, 4, "a\nb\nc\nd\ne\nf\n", [][]string{{"a", "c", "e"}, {"b", "d", "f"}}},
+		{RowMajor, true, 3, "a\nb\nc\nd\ne\nf\ng\n", [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}},
+		{RowMajor, false, 3, "a\nb\nc\nd\ne\nf\ng\n", [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}},
+	}
+
+	for _, test := range tests {
+		w := NewWriter(io.Discard, 0)
+		w.SetOrder(test.order)
+		w.SetBalanced(test.balanced)
+		w.SetColumns(test.n)
+		w.WriteString(test.input)
+		if got := w.Layout(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("order %v, balanced %v, %d columns, input %q: got %q, want %q",
+				test.order, test.balanced, test.n, test.input, got, test.want)
+		}
+	}
+}
+
+func TestBlockAlign(t *testing.T) {
+	tests := []struct {
+		align  Align
+		format Format
+		width  int
+		input  string
+		want   string
+	}{
+		{Left, Text, 10, "a\nbb\nc\n", "a  c\nbb\n"},
+		{Right, Text, 10, "a\nbb\nc\n", "     a  c\n     bb\n"},
+		{Center, Text, 10, "a\nbb\nc\n", "  a  c\n  bb\n"},
+		{Right, Text, 0, "a\nbb\nc\n", "a\nbb\nc\n"},
+		{Right, Text, 10, "a\nbb\n", "     a bb\n"},
+		{Right, Table, 12, "a\nb\n", "  ┌───┬───┐\n  │ a │ b │\n  └───┴───┘\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetMaxColumns(2)
+		w.SetFormat(test.format)
+		w.SetBorder(true)
+		w.SetBlockAlign(test.align)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("align %v, format %d, input %q: got %q, want %q", test.align, test.format, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	tests := []struct {
+		sep   string
+		width int
+		input string
+		want  string
+	}{
+		{" | ", 11, "a\nbb\nc\nd", "a  | c | d\nbb\n"},
+		{" | ", 6, "a\nbb\nc\nd", "a\nbb\nc\nd\n"},
+		{" | ", 6, "a\nb\nc\nd\ne", "a | d\nb | e\nc\n"},
+		{"\t", 6, "a\nbb\nc\nd", "a \tc\nbb\td\n"},
+		{"│ ", 8, "a\nb\nc", "a│ b│ c\n"},
+		{"＊", 8, "a\nb\nc", "a＊b＊c\n"},
+		{"＊", 7, "a\nb\nc", "a＊c\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetSeparator(test.sep)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("sep %q, width %d, input %q: got %q, want %q", test.sep, test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		align Align
+		input string
+		want  string
+	}{
+		{Left, "1\n22\n333\n4\n55\n666", "1   4\n22  55\n333 666\n"},
+		{Right, "1\n22\n333\n4\n55\n666", "  1   4\n 22  55\n333 666\n"},
+		{Center, "1\n22\n333\n4\n55\n666", " 1   4\n22  55\n333 666\n"},
+		{Right, "é\nab\nçàé\nb", " é çàé\nab   b\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 8)
+		w.SetAlign(test.align)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("align %v, input %q: got %q, want %q", test.align, test.input, got, test.want)
+		}
+	}
+}
+
+func TestColumnWidths(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  string
+	}{
+		{15, "aaaaaaaa\nb\nc\nd", "aaaaaaaa b c d\n"},
+		{14, "aaaaaaaa\nb\nc\nd", "aaaaaaaa c d\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		columnate(t, NewWriter(&buf, test.width), test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestTabs(t *testing.T) {
+	tests := []struct {
+		tabwidth int
+		width    int
+		input    string
+		want     string
+	}{
+		{8, 12, "\ta\nb\nc\nd", "        a c\nb         d\n"},
+		{4, 10, "\ta\nb\tc\nd\ne", "    a d e\nb   c\n"},
+		{4, 3, "ab\tc\nd", "ab  c\nd\n"},
+		{0, 20, "\ta\nb", "\ta b\n"},
+		{4, 0, "abc\td\na\tb\nabcde\tf\tg", "abc d\na   b\nabcde   f   g\n"},
+		{8, 0, "日本\tx", "日本    x\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetTabWidth(test.tabwidth)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("tabwidth %d, input %q: got %q, want %q", test.tabwidth, test.input, got, test.want)
+		}
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	var crlf, lf bytes.Buffer
+	columnate(t, NewWriter(&crlf, 6), "a\r\nbb\r\ncc\r\n")
+	columnate(t, NewWriter(&lf, 6), "a\nbb\ncc\n")
+	if crlf.String() != lf.String() {
+		t.Errorf("got %q, want %q", crlf.String(), lf.String())
+	}
+}
+
+func TestTrailingNewline(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  string
+	}{
+		{80, "a\nb\nc\n", "a b c\n"},
+		{2, "a\nb\nc\n", "a\nb\nc\n"},
+		{2, "a\n\nc\n\n", "a\n\nc\n\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		columnate(t, NewWriter(&buf, test.width), test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestReuse(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	columnate(t, w, "a\nb\n")
+	buf.Reset()
+	columnate(t, w, "c\nd\n")
+	if got, want := buf.String(), "c d\n"; got != want {
+		t.Errorf("second flush: got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	w.Write([]byte("e\nf\n"))
+	w.Reset()
+	columnate(t, w, "g\n")
+	if got, want := buf.String(), "g\n"; got != want {
+		t.Errorf("after reset: got %q, want %q", got, want)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	w.Write([]byte("a\nb\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got, want := buf.String(), "a b\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := w.Write([]byte("c\n")); err != ErrClosed {
+		t.Errorf("write after close: got error %v, want %v", err, ErrClosed)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
+
+func TestSetWidth(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	w.SetWidth(4)
+	if got := w.Width(); got != 4 {
+		t.Errorf("Width() = %d, want 4", got)
+	}
+	columnate(t, w, "a\nb\nc\nd\n")
+	if got, want := buf.String(), "a c\nb d\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWidthAuto(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 4)
+	w.SetWidthAuto()
+	if got := w.Width(); got != defaultTermWidth {
+		t.Errorf("Width() = %d, want %d", got, defaultTermWidth)
+	}
+	w.SetWidth(4)
+	if got := w.Width(); got != 4 {
+		t.Errorf("Width() after SetWidth = %d, want 4", got)
+	}
+}
+
+func TestMaxColumns(t *testing.T) {
+	tests := []struct {
+		max   int
+		input string
+		want  string
+	}{
+		{0, "a\nb\nc\nd\ne\nf\n", "a b c d e f\n"},
+		{2, "a\nb\nc\nd\ne\nf\n", "a d\nb e\nc f\n"},
+		{10, "a\nb\nc\nd\ne\nf\n", "a b c d e f\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 80)
+		w.SetMaxColumns(test.max)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("max %d, input %q: got %q, want %q", test.max, test.input, got, test.want)
+		}
+	}
+}
+
+func TestMinColumns(t *testing.T) {
+	tests := []struct {
+		min   int
+		width int
+		input string
+		want  string
+	}{
+		{3, 1, "a\nb\nc\nd\ne\nf\n", "a c e\nb d f\n"},
+		{3, 80, "a\nb\nc\nd\ne\nf\n", "a b c d e f\n"},
+		{3, 1, "a\nb\n", "a\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetMinColumns(test.min)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("min %d, width %d, input %q: got %q, want %q", test.min, test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	for _, s := range []string{"a\n", "b\n", "c\n"} {
+		if n, err := w.WriteString(s); n != len(s) || err != nil {
+			t.Fatalf("WriteString(%q) = %d, %v", s, n, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a b c\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadFrom(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	n, err := io.Copy(w, strings.NewReader("a\nb\nc\n"))
+	if n != 6 || err != nil {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a b c\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	readErr := errors.New("read failed")
+	n, err = w.ReadFrom(&errReader{"d\ne\n", readErr})
+	if n != 4 || err != readErr {
+		t.Fatalf("ReadFrom = %d, %v; want 4, %v", n, err, readErr)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "d e\n"; got != want {
+		t.Errorf("after read error: got %q, want %q", got, want)
+	}
+}
+
+func TestFlushSize(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  Size
+	}{
+		{80, "a\nb\nc\n", Size{Columns: 3, Rows: 1}},
+		{4, "a\nb\nc\nd\ne\n", Size{Columns: 2, Rows: 3}},
+		{80, "", Size{}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.WriteString(test.input)
+		got, err := w.FlushSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("width %d, input %q: got %+v, want %+v", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		sort  bool
+		input string
+		want  string
+	}{
+		{false, "c\nb\nd\na\n", "c d\nb a\n"},
+		{true, "c\nb\nd\na\n", "a c\nb d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 4)
+		w.SetSort(test.sort)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("sort %v, input %q: got %q, want %q", test.sort, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSortOptions(t *testing.T) {
+	tests := []struct {
+		caseFold, reverse bool
+		input             string
+		want              string
+	}{
+		{false, false, "banana\nApple\napple\nÉclair\nBanana\n", "Apple\nBanana\napple\nbanana\nÉclair\n"},
+		{true, false, "banana\nApple\napple\nÉclair\nBanana\n", "Apple\napple\nBanana\nbanana\nÉclair\n"},
+		{false, true, "b\na\nc\n", "c\nb\na\n"},
+		{true, true, "b\nA\na\nC\n", "C\nb\na\nA\n"},
+		{true, false, "éclair\nÉCLAIR\neclair\n", "eclair\nÉCLAIR\néclair\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetSort(true)
+		w.SetSortOptions(test.caseFold, test.reverse)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("caseFold %v, reverse %v, input %q: got %q, want %q", test.caseFold, test.reverse, test.input, got, test.want)
+		}
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	tests := []struct {
+		caseFold bool
+		input    string
+		want     string
+	}{
+		{false, "file10\nfile2\nfile1\n", "file1\nfile2\nfile10\n"},
+		{false, "file01\nfile1\nfile001\nfile0\n", "file0\nfile1\nfile01\nfile001\n"},
+		{false, "file01b\nfile1a\n", "file1a\nfile01b\n"},
+		{false, "v1.10.2\nv1.2.10\nv1.2.9\nv1.10\n", "v1.2.9\nv1.2.10\nv1.10\nv1.10.2\n"},
+		{true, "File10\nfile9\nFILE9x\n", "file9\nFILE9x\nFile10\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetSort(true)
+		w.SetSortOptions(test.caseFold, false)
+		w.SetNaturalSort(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("caseFold %v, input %q: got %q, want %q", test.caseFold, test.input, got, test.want)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		sort  bool
+		input string
+		want  string
+	}{
+		{false, "b\na\nb\n\nc\na\n\n", "b\na\n\nc\n"},
+		{true, "b\na\nb\nc\na\n", "a\nb\nc\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetUnique(true)
+		w.SetSort(test.sort)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("sort %v, input %q: got %q, want %q", test.sort, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSkipBlank(t *testing.T) {
+	tests := []struct {
+		skip  bool
+		input string
+		want  string
+	}{
+		{false, "a\n\nb\n \t\nc\n", "a\n\nb\n        \nc\n"},
+		{true, "a\n\nb\n \t\nc\n", "a\nb\nc\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetSkipBlank(test.skip)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("skip %v, input %q: got %q, want %q", test.skip, test.input, got, test.want)
+		}
+	}
+}
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		trim  bool
+		input string
+		want  string
+	}{
+		{false, "  a\nb  \nc\nd\n", "  a c\nb   d\n"},
+		{true, "  a\nb  \nc\nd\n", "a c d\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetTrim(test.trim)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("trim %v, input %q: got %q, want %q", test.trim, test.input, got, test.want)
+		}
+	}
+}
+
+func TestMaxCellWidth(t *testing.T) {
+	tests := []struct {
+		max   int
+		ansi  bool
+		input string
+		want  string
+	}{
+		{4, false, "abcdef\nab\nabcd\n", "abc…\nab\nabcd\n"},
+		{4, false, "日本語\n", "日…\n"},
+		{5, false, "日本語\n", "日本…\n"},
+		{1, false, "abc\n", "…\n"},
+		{3, true, "\x1b[31mabcd\x1b[0m\n", "\x1b[31mab…\x1b[0m\n"},
+		{0, false, "abcdef\n", "abcdef\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetMaxCellWidth(test.max)
+		w.SetANSIAware(test.ansi)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("max %d, input %q: got %q, want %q", test.max, test.input, got, test.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		maxcell int
+		width   int
+		input   string
+		want    string
+	}{
+		{5, 80, "abcdefgh\nx\n", "abcde x\nfgh\n"},
+		{5, 80, "ab cd ef\nx\n", "ab cd x\nef\n"},
+		{0, 4, "abcdefgh\n", "abcd\nefgh\n"},
+		{3, 80, "日本語\nx\n", "日  x\n本\n語\n"},
+		{4, 9, "a\nbbbbbbbbb\nc\nd\n", "a    c d\nbbbb\nbbbb\nb\n"},
+		{0, 1, "日本\n", "日\n本\n"},
+		{1, 80, "ab日\n", "a\nb\n日\n"},
+		{1, 10, "世\n世\n世\n世\n", "世 世 世\n世\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetMaxCellWidth(test.maxcell)
+		w.SetWrap(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("maxcell %d, width %d, input %q: got %q, want %q", test.maxcell, test.width, test.input, got, test.want)
+		}
+	}
+
+	// a rune too wide to wrap is too wide for the Writer
+	w := NewWriter(io.Discard, 1)
+	w.SetWrap(true)
+	w.WriteString("世\n")
+	if w.Fits() {
+		t.Errorf("Fits() = true for a wide rune at width 1, want false")
+	}
+}
+
+func TestPadLastColumn(t *testing.T) {
+	tests := []struct {
+		align Align
+		input string
+		want  string
+	}{
+		{Left, "a\nbb\nc\nddd\ne\n", "a  c   e\nbb ddd  \n"},
+		{Right, "a\nbb\nc\nddd\ne\n", " a   c e\nbb ddd  \n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 10)
+		w.SetAlign(test.align)
+		w.SetPadLastColumn(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("align %v, input %q: got %q, want %q", test.align, test.input, got, test.want)
+		}
+	}
+}
+
+func TestTrimTrailing(t *testing.T) {
+	tests := []struct {
+		format  Format
+		padlast bool
+		input   string
+		want    string
+	}{
+		{Text, false, "a\nbb\nc\nddd\ne\n", "a  c   e\nbb ddd\n"},
+		{Text, false, "a  \nbb\t\nc\n", "a\nbb\nc\n"},
+		{Text, true, "a\nbb\nc\nddd\ne\n", "a  c   e\nbb ddd  \n"},
+		{Table, false, "a\nbb\nc\nddd\ne\n", "a  │ ddd\nbb │ e\nc  │\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 10)
+		w.SetFormat(test.format)
+		w.SetPadLastColumn(test.padlast)
+		w.SetTrimTrailing(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("format %d, padlast %v, input %q: got %q, want %q", test.format, test.padlast, test.input, got, test.want)
+		}
+		if test.padlast {
+			continue
+		}
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if s := strings.TrimSuffix(line, "\n"); strings.TrimRight(s, " \t") != s {
+				t.Errorf("format %d, input %q: trailing space in line %q", test.format, test.input, line)
+			}
+		}
+	}
+}
+
+func TestPadRune(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	w.SetOrder(RowMajor)
+	w.SetMaxColumns(2)
+	w.SetPadRune('.')
+	w.SetGap(2)
+	columnate(t, w, "Intro\n1\nChapter one\n3\n")
+	want := "Intro......  1\nChapter one  3\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		align Align
+		input string
+		want  string
+	}{
+		{Left, "name\nx\nsize\n10\n", "| name | size |\n| ---- | ---- |\n| x    | 10   |\n"},
+		{Right, "a\nb|c\nd\n", "|    a |   d |\n| ---: | --: |\n| b\\|c |     |\n"},
+		{Center, "a\nb\n", "|  a  |  b  |\n| :-: | :-: |\n"},
+		{Left, "a\nb\ncccccccccccccccccccc\nd\n", "| a                    | b   |\n| -------------------- | --- |\n| cccccccccccccccccccc |     |\n| d                    |     |\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetMaxColumns(2)
+		w.SetAlign(test.align)
+		w.SetFormat(Markdown)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("align %v, input %q: got %q, want %q", test.align, test.input, got, test.want)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+		want   string
+	}{
+		{CSV, "a\nb,c\nd\"e\n", "a,\"d\"\"e\"\n\"b,c\",\n"},
+		{TSV, "a\nb\tc\nd\n", "a\td\n\"b\tc\"\t\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 80)
+		w.SetMaxColumns(2)
+		w.SetTabWidth(0)
+		w.SetFormat(test.format)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("format %v, input %q: got %q, want %q", test.format, test.input, got, test.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"a\nb\nc\n", `[["a","c"],["b"]]` + "\n"},
+		{"a\"<\nb\n", `[["a\"<","b"]]` + "\n"},
+		{"a\nb\ncccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc\nd\ne\n",
+			`[["a","b"],["cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"],["d","e"]]` + "\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 80)
+		w.SetMaxColumns(2)
+		w.SetFormat(JSON)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestRowTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 5)
+	w.SetRowTemplate(template.Must(template.New("row").Parse(
+		"<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>\n")))
+	columnate(t, w, "a\nb\nc&\n")
+	want := "<tr><td>a</td><td>c&</td></tr>\n<tr><td>b</td></tr>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGrid(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 4)
+	w.WriteString("a\nb\nc\nd\ne\n")
+	g := w.Grid()
+
+	// the Grid is unaffected by later changes to the Writer
+	w.WriteString("f\n")
+	w.SetSeparator("|")
+
+	if got := g.Columns(); got != 2 {
+		t.Errorf("Columns: got %d, want 2", got)
+	}
+	if got := g.Rows(); got != 3 {
+		t.Errorf("Rows: got %d, want 3", got)
+	}
+	for _, test := range []struct {
+		r, c int
+		want string
+	}{
+		{0, 0, "a"}, {0, 1, "d"}, {2, 0, "c"}, {2, 1, ""}, {3, 0, ""}, {-1, 0, ""},
+	} {
+		if got := g.Cell(test.r, test.c); got != test.want {
+			t.Errorf("Cell(%d, %d): got %q, want %q", test.r, test.c, got, test.want)
+		}
+	}
+	var dst bytes.Buffer
+	if err := g.Render(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dst.String(), "a d\nb e\nc\n"; got != want {
+		t.Errorf("Render: got %q, want %q", got, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("backing writer got %q, want nothing", buf.String())
+	}
+
+	w.SetWidthAuto()
+	g = w.Grid()
+	if g.w.autowidth || g.w.maxwidth != termWidth(&buf) {
+		t.Errorf("SetWidthAuto: grid width %d, auto %v, want %d", g.w.maxwidth, g.w.autowidth, termWidth(&buf))
+	}
+}
+
+// TestMultibyteFit checks that accented words fit as many columns as their
+// unaccented equivalents, however many bytes they take.
+func TestMultibyteFit(t *testing.T) {
+	ascii := NewWriter(io.Discard, 0)
+	ascii.WriteString("cafe\nnaive\nete\nao\n")
+	accented := NewWriter(io.Discard, 0)
+	accented.WriteString("café\nnaïve\nété\nāō\n")
+	for width := 1; width < 24; width++ {
+		if got, want := accented.FitColumns(width), ascii.FitColumns(width); got != want {
+			t.Errorf("width %d: got %d columns, want %d", width, got, want)
+		}
+	}
+}
+
+// TestColumnSearch checks that starting the search for the number of columns
+// from fits gives the same result as starting it from a single column.
+func TestColumnSearch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		w := NewWriter(io.Discard, 1+r.Intn(200))
+		w.SetOrder(Order(r.Intn(2)))
+		w.SetSeparator(strings.Repeat(" ", r.Intn(3)))
+		w.SetCellPadding(r.Intn(2), r.Intn(2))
+		w.SetMaxColumns(r.Intn(10))
+		widths := make([]int, r.Intn(50))
+		for j := range widths {
+			widths[j] = r.Intn(12)
+		}
+
+		want := 1
+		for w.split(widths, want) {
+			want++
+		}
+		got := w.fits(widths)
+		for w.split(widths, got) {
+			got++
+		}
+		if got != want {
+			t.Fatalf("width %d, widths %v: got %d columns, want %d", w.Width(), widths, got, want)
+		}
+	}
+}
+
+// TestParallelMeasure checks that measuring a large input in parallel gives
+// the same widths as measuring it serially.
+func TestParallelMeasure(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	runes := []rune("aé世\x1b[m🇨🇦 ")
+	words := make([]string, 3*parallelWords+1)
+	for i := range words {
+		b := make([]rune, r.Intn(10))
+		for j := range b {
+			b[j] = runes[r.Intn(len(runes))]
+		}
+		words[i] = string(b)
+	}
+	for _, procs := range []int{3, 8} {
+		w := NewWriter(io.Discard, 80)
+		w.SetANSIAware(true)
+		w.SetGraphemeAware(true)
+		w.SetMaxCellWidth(6)
+		w.SetWrap(true)
+		want := make([]int, len(words))
+		w.measureInto(want, words)
+		prev := runtime.GOMAXPROCS(procs)
+		got := w.measure(words)
+		runtime.GOMAXPROCS(prev)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GOMAXPROCS %d: parallel widths differ from serial widths", procs)
+		}
+	}
+}
+
+func TestFlushReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 7)
+	w.WriteString("a\nb")
+	if err := w.FlushReader(strings.NewReader("b\nc\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a bb c\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// a read error writes nothing and keeps the buffered input
+	buf.Reset()
+	readErr := errors.New("read error")
+	w.WriteString("d\n")
+	err := w.FlushReader(&errReader{"e\n", readErr})
+	var re *ReadError
+	if !errors.As(err, &re) || re.Err != readErr {
+		t.Errorf("got error %v, want a *ReadError for %v", err, readErr)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("after read error: got %q, want nothing", buf.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "d\n"; got != want {
+		t.Errorf("after read error: got %q, want %q", got, want)
+	}
+}
+
+func TestNewReaderWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewReaderWriter(strings.NewReader("b\nc\n"), &buf, 6)
+	w.WriteString("a\n")
+	if got := w.String(); got != "a\n" {
+		t.Errorf("String: got %q, want %q", got, "a\n")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a b c\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// FlushTo keeps what it reads for the next destination
+	w = NewReaderWriter(strings.NewReader("b\n"), &buf, 6)
+	w.WriteString("a\n")
+	for i := 0; i < 2; i++ {
+		var dst bytes.Buffer
+		if err := w.FlushTo(&dst); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := dst.String(), "a b\n"; got != want {
+			t.Errorf("FlushTo %d: got %q, want %q", i, got, want)
+		}
+	}
+
+	// read and write errors are told apart
+	readErr := errors.New("read error")
+	w = NewReaderWriter(&errReader{"a\n", readErr}, &buf, 6)
+	err := w.Flush()
+	var re *ReadError
+	var we *WriteError
+	if !errors.As(err, &re) || errors.As(err, &we) || !errors.Is(err, readErr) {
+		t.Errorf("read: got error %v, want a *ReadError", err)
+	}
+	w = NewReaderWriter(strings.NewReader("a\n"), &shortWriter{n: 0}, 6)
+	err = w.Flush()
+	if !errors.As(err, &we) || errors.As(err, &re) {
+		t.Errorf("write: got error %v, want a *WriteError", err)
+	}
+}
+
+func TestFlushTo(t *testing.T) {
+	var buf, dst bytes.Buffer
+	w := NewWriter(&buf, 4)
+	w.WriteString("a\nb\nc\n")
+	w.SetWidth(80)
+	if err := w.FlushTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dst.String(), "a b c\n"; got != want {
+		t.Errorf("FlushTo: got %q, want %q", got, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("backing writer got %q, want nothing", buf.String())
+	}
+
+	// the buffered input is kept for other destinations
+	dst.Reset()
+	w.SetWidth(4)
+	if err := w.FlushTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dst.String(), "a c\nb\n"; got != want {
+		t.Errorf("second FlushTo: got %q, want %q", got, want)
+	}
+
+	// Flush still writes to buf, and discards the input
+	w.WriteString("d\n")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a c\nb d\n"; got != want {
+		t.Errorf("Flush: got %q, want %q", got, want)
+	}
+	if got := w.String(); got != "" {
+		t.Errorf("after Flush: got %q still buffered", got)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	tests := []struct {
+		format    Format
+		skipblank bool
+		input     string
+	}{
+		{Text, false, ""},
+		{Table, false, ""},
+		{Markdown, false, ""},
+		{CSV, false, ""},
+		{JSON, false, ""},
+		{Text, true, "\n\n"},
+		{Table, true, "\n \n"},
+	}
+
+	for _, test := range tests {
+		w := NewWriter(&shortWriter{n: 0}, 80)
+		w.SetFormat(test.format)
+		w.SetBorder(true)
+		w.SetHeader(true)
+		w.SetSkipBlank(test.skipblank)
+		w.WriteString(test.input)
+		if n, err := w.FlushN(); n != 0 || err != nil {
+			t.Errorf("format %d, input %q: FlushN = %d, %v; want 0, nil", test.format, test.input, n, err)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 4)
+	w.WriteString("a\nb\nc\nd\ne\n")
+	got := w.Layout()
+	want := [][]string{{"a", "d"}, {"b", "e"}, {"c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Layout wrote %q", buf.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a d\nb e\nc\n"; got != want {
+		t.Errorf("flush after Layout: got %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.WriteString("abc\n")
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), strings.Repeat("abc\n", 800); got != want {
+		t.Errorf("got %d bytes of corrupted output", len(got))
+	}
+}
+
+func BenchmarkFlush(b *testing.B) {
+	var input strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&input, "file%d.txt\n", i)
+	}
+	w := NewWriter(io.Discard, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.WriteString(input.String())
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFlushReader(b *testing.B) {
+	var input strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&input, "file%d.txt\n", i)
+	}
+	w := NewWriter(io.Discard, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.FlushReader(strings.NewReader(input.String())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMeasure(b *testing.B) {
+	words := make([]string, 1000000)
+	for i := range words {
+		words[i] = fmt.Sprintf("file%d.txt", i)
+	}
+	for _, bench := range []struct {
+		name  string
+		procs int
+	}{
+		{"serial", 1},
+		{"parallel", runtime.NumCPU()},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(bench.procs))
+			w := NewWriter(io.Discard, 200)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.measure(words)
+			}
+		})
+	}
+}
+
+func BenchmarkSmallFlush(b *testing.B) {
+	var input strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&input, "file%d.txt\n", i)
+	}
+	w := NewWriter(io.Discard, 80)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.WriteString(input.String())
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// writeCounter counts the calls to its Write method, and those that write
+// nothing.
+type writeCounter struct {
+	writes, empty int
+}
+
+func (wc *writeCounter) Write(p []byte) (int, error) {
+	wc.writes++
+	if len(p) == 0 {
+		wc.empty++
+	}
+	return len(p), nil
+}
+
+// BenchmarkFlushWrites reports the number of calls to the backing
+// io.Writer's Write method, each of which may be a system call.
+func BenchmarkFlushWrites(b *testing.B) {
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "file%d.txt\n", i)
+	}
+	var wc writeCounter
+	w := NewWriter(&wc, 80)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.WriteString(input.String())
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(wc.writes)/float64(b.N), "writes/op")
+	b.ReportMetric(float64(wc.empty)/float64(b.N), "empty-writes/op")
+}
+
+func TestJustify(t *testing.T) {
+	tests := []struct {
+		width int
+		gap   float64
+		input string
+		want  string
+	}{
+		{11, 0, "a\nb\nc\nd\n", "a   b  c  d\n"},
+		{12, 0, "aa\nb\nc\n", "aa    b    c\n"},
+		{2, 0, "a\nb\n", "a\nb\n"},
+		{29, 0.5, "aaaaaaaa\nbb\ncc\n", "aaaaaaaa          bb       cc\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width+1)
+		if test.gap > 0 {
+			w.SetProportionalGap(test.gap, 1)
+		}
+		w.SetJustify(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestNonPositiveWidth(t *testing.T) {
+	for _, width := range []int{0, -1, -80} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, width)
+		w.SetJustify(true)
+		w.SetWrap(true)
+		columnate(t, w, "a\nbbbbbbbbbbbbbbbbbbbb\nc\n")
+		if got, want := buf.String(), "a\nbbbbbbbbbbbbbbbbbbbb\nc\n"; got != want {
+			t.Errorf("width %d: got %q, want %q", width, got, want)
+		}
+	}
+}
+
+func TestWriteByteRune(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	var _ io.ByteWriter = w
+	w.WriteByte('a')
+	w.WriteByte('\n')
+	if n, err := w.WriteRune('日'); n != 3 || err != nil {
+		t.Fatalf("WriteRune = %d, %v", n, err)
+	}
+	w.WriteRune('\n')
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a 日\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGraphemeAware(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"é", 1},
+		{"👨‍👩‍👧", 2},
+		{"👍🏽", 2},
+		{"🇯🇵🇫🇷", 4},
+		{"☺️", 2},
+		{"ab́c", 3},
+	}
+
+	w := NewWriter(nil, 80)
+	w.SetGraphemeAware(true)
+	for _, test := range tests {
+		if got := w.strwidth(test.input); got != test.want {
+			t.Errorf("strwidth(%q) = %d, want %d", test.input, got, test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	w = NewWriter(&buf, 1)
+	w.SetGraphemeAware(true)
+	w.SetMaxCellWidth(3)
+	columnate(t, w, "éééé\n")
+	if got, want := buf.String(), "éé…\n"; got != want {
+		t.Errorf("truncate: got %q, want %q", got, want)
+	}
+}
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		border bool
+		width  int
+		input  string
+		want   string
+	}{
+		{false, 10, "a\nbb\nc\n", "a  │ c\nbb │  \n"},
+		{false, 11, "a\nbb\nc\n", "a │ bb │ c\n"},
+		{true, 14, "a\nbb\nc\n", "┌────┬───┐\n│ a  │ c │\n│ bb │   │\n└────┴───┘\n"},
+		{true, 15, "a\nbb\nc\n", "┌───┬────┬───┐\n│ a │ bb │ c │\n└───┴────┴───┘\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetFormat(Table)
+		w.SetBorder(test.border)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("border %v, width %d, input %q: got %q, want %q", test.border, test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		repeat int
+		format Format
+		input  string
+		want   string
+	}{
+		{0, Text, "NAME\na\nbbbbb\nc\n", "NAME  NAME\n----- ----\na     c\nbbbbb\n"},
+		{1, Text, "NAME\na\nbbbbb\nc\n", "NAME  NAME\n----- ----\na     c\nNAME  NAME\n----- ----\nbbbbb\n"},
+		{0, Table, "N\na\nb\n", "N │ N\n─ │ ─\na │ b\n"},
+		{0, Text, "H\naaaaaaaaaaaa\nb\nc\n", "H\n-\naaaaaaaaaaaa\nb c\n"},
+		{0, Text, "H\na\nbbbbbbbbbbbb\nc\n", "H\n-\na\nbbbbbbbbbbbb\nc\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 12)
+		w.SetFormat(test.format)
+		w.SetHeader(true)
+		w.SetHeaderRepeat(test.repeat)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("repeat %d, input %q: got %q, want %q", test.repeat, test.input, got, test.want)
+		}
+	}
+}
+
+// TestHeaderInput checks that the header is exempt from the filters, and is
+// left in the data by the formats that do not write it.
+func TestHeaderInput(t *testing.T) {
+	tests := []struct {
+		format  Format
+		sort    bool
+		oneline bool
+		input   string
+		want    string
+	}{
+		{Text, true, false, "size\n3\n1\n2\n", "size size size\n---- ---- ----\n1    2    3\n"},
+		{Text, false, true, "N\na\nb\n", "N N\n- -\na b\n"},
+		{CSV, false, false, "N\na\n", "N,a\n"},
+		{Markdown, false, false, "N\na\n", "| N   | a   |\n| --- | --- |\n"},
+		{Text, false, false, "name\tsize\nmain.go\t1024\n", "name    size\nmain.go 1024\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetFormat(test.format)
+		w.SetSort(test.sort)
+		w.SetSingleLineWhenFits(test.oneline)
+		w.SetFieldDelimiter("\t")
+		w.SetHeader(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("format %d, sort %v, oneline %v, input %q: got %q, want %q", test.format, test.sort, test.oneline, test.input, got, test.want)
+		}
+	}
+}
+
+func TestNumbered(t *testing.T) {
+	tests := []struct {
+		order Order
+		input string
+		want  string
+	}{
+		{ColumnMajor, "a\nb\nc\n", "1 a 2 b 3 c\n"},
+		{ColumnMajor, "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", " 1 a  3 c  5 e  7 g  9 i 10 j\n 2 b  4 d  6 f  8 h\n"},
+		{RowMajor, "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", " 1 a  2 b  3 c  4 d  5 e  6 f\n 7 g  8 h  9 i 10 j\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 30)
+		w.SetOrder(test.order)
+		w.SetNumbered(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("order %d, input %q: got %q, want %q", test.order, test.input, got, test.want)
+		}
+	}
+}
+
+func TestAutoAlign(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"apple\n10\npear\n2.5\nfig\n-300\n", "apple   10\npear   2.5\nfig   -300\n"},
+		{"apple\n10\npear\nn/a\n", "apple 10\npear  n/a\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 80)
+		w.SetOrder(RowMajor)
+		w.SetMaxColumns(2)
+		w.SetAutoAlign(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFieldDelimiter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		size  Size
+	}{
+		{"name\tsize\nmain.go\t1024\n", "name    size\nmain.go 1024\n", Size{2, 2}},
+		{"a\tb\tc\nlonger\td\n", "a      b c\nlonger d\n", Size{3, 2}},
+		{"x\ty\na\nb\nc\nd\n", "x y\na b c d\n", Size{4, 2}},
+		{"a\nb\nk\tv\n", "a b\nk v\n", Size{2, 2}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetFieldDelimiter("\t")
+		io.WriteString(w, test.input)
+		size, err := w.FlushSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+		if size != test.size {
+			t.Errorf("input %q: got size %v, want %v", test.input, size, test.size)
+		}
+	}
+}
+
+func TestLineTerminator(t *testing.T) {
+	tests := []struct {
+		eol      string
+		trailing bool
+		format   Format
+		input    string
+		want     string
+	}{
+		{"\r\n", true, Text, "a\nb\nc\n", "a c\r\nb\r\n"},
+		{"\n", false, Text, "a\nb\nc\n", "a c\nb"},
+		{"\r\n", false, CSV, "aa\nbb\n", "aa\r\nbb"},
+		{"", true, Text, "aa\nbb\n", "aabb"},
+		{"\n", false, Text, "", ""},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 4)
+		w.SetFormat(test.format)
+		w.SetLineTerminator(test.eol)
+		w.SetTrailingNewline(test.trailing)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("eol %q, trailing %v, input %q: got %q, want %q", test.eol, test.trailing, test.input, got, test.want)
+		}
+	}
+}
+
+// shortWriter accepts at most n bytes, then fails.
+type shortWriter struct {
+	n int
+}
+
+func (sw *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > sw.n {
+		n := sw.n
+		sw.n = 0
+		return n, io.ErrShortWrite
+	}
+	sw.n -= len(p)
+	return len(p), nil
+}
+
+func TestFlushN(t *testing.T) {
+	tests := []struct {
+		eol   string
+		input string
+		want  int
+	}{
+		{"\n", "", 0},
+		{"\n", "a\nb\nc\n", len("a c\nb\n")},
+		{"\r\n", "a\nb\nc\n", len("a c\r\nb\r\n")},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 4)
+		w.SetLineTerminator(test.eol)
+		io.WriteString(w, test.input)
+		n, err := w.FlushN()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != test.want || n != buf.Len() {
+			t.Errorf("eol %q, input %q: got %d bytes, want %d", test.eol, test.input, n, test.want)
+		}
+	}
+
+	w := NewWriter(&shortWriter{n: 5}, 4)
+	io.WriteString(w, "a\nb\nc\n")
+	if n, err := w.FlushN(); n != 5 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("short write: got %d, %v, want 5, %v", n, err, io.ErrShortWrite)
+	}
+}
+
+func TestOutputConcurrentRead(t *testing.T) {
+	w := NewWriter(io.Discard, 20)
+	io.WriteString(w, strings.Repeat("abc\n", 100))
+	want := w.String()
+	out := w.Output()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var total int
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 3)
+			for {
+				n, err := out.Read(p)
+				mu.Lock()
+				total += n
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if total != len(want) {
+		t.Errorf("read %d bytes, want %d", total, len(want))
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 4)
+	io.WriteString(w, "a\nb\nc\n")
+	want := "a c\nb\n"
+
+	var dst bytes.Buffer
+	if _, err := io.Copy(&dst, w.Output()); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.String(); got != want {
+		t.Errorf("io.Copy: got %q, want %q", got, want)
+	}
+	got, err := io.ReadAll(w.Output())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Read: got %q, want %q", got, want)
+	}
+	if got := w.String(); got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	if got := w.Bytes(); string(got) != want {
+		t.Errorf("Bytes: got %q, want %q", got, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("backing writer got %q, want nothing", buf.String())
+	}
+
+	// the buffered input is still there for Flush
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("Flush: got %q, want %q", got, want)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		width int
+		items []string
+		want  string
+	}{
+		{10, nil, ""},
+		{10, []string{"a", "b", "c"}, "a b c\n"},
+		{4, []string{"a", "b", "c"}, "a c\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Print(&buf, test.width, test.items); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("Print(%d, %q): got %q, want %q", test.width, test.items, got, test.want)
+		}
+		if got := Sprint(test.width, test.items); got != test.want {
+			t.Errorf("Sprint(%d, %q): got %q, want %q", test.width, test.items, got, test.want)
+		}
+	}
+}
+
+func TestWideWord(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a\nb\nc\nd\n", "a b c d\n"},
+		{"a\nb\nc\nd\nabcdefghij\ne\nf\n", "a b c d\nabcdefghij\ne f\n"},
+		{"abcdefghij\nklmnopqrst\n", "abcdefghij\nklmnopqrst\n"},
+		{"a\nb\nc\nd\ne\nf\ng\nh\nabcdefghij\n", "a c e g\nb d f h\nabcdefghij\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 8)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestJustifyLast(t *testing.T) {
+	tests := []struct {
+		width int
+		input string
+		want  string
+	}{
+		{12, "a\nb\nc\nd\n", "a  b  c    d\n"},
+		{10, "a\nb\nc\nd\n", "a  b  c  d\n"},
+		{12, "aa\nb\nc\nd\ne\n", "aa  c  d   e\nb\n"},
+		{3, "a\nb\n", "a\nb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width+1)
+		w.SetGap(2)
+		w.SetJustifyLast(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+	}
+}
+
+func TestCollation(t *testing.T) {
+	tests := []struct {
+		tag     language.Tag
+		natural bool
+		input   string
+		want    string
+	}{
+		{language.German, false, "zebra\nÄpfel\nBirne\napfel\n", "apfel\nÄpfel\nBirne\nzebra\n"},
+		{language.Swedish, false, "ö\nz\no\n", "o\nz\nö\n"},
+		{language.English, true, "file10\nfile2\nFile1\n", "File1\nfile2\nfile10\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 0)
+		w.SetSort(true)
+		w.SetNaturalSort(test.natural)
+		w.SetCollation(test.tag)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("%v, input %q: got %q, want %q", test.tag, test.input, got, test.want)
+		}
+	}
+}
+
+func TestWidthFunc(t *testing.T) {
+	tests := []struct {
+		f     func(string) int
+		width int
+		input string
+		want  string
+	}{
+		{nil, 10, "日本\na\nb\nc\n", "日本 b c\na\n"},
+		{utf8.RuneCountInString, 10, "日本\na\nb\nc\n", "日本 a b c\n"},
+		{nil, 8, "é\na\nb\nc\n", "é a b c\n"},
+		{func(s string) int { return len(s) }, 8, "é\na\nb\nc\n", "é b c\na\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetWidthFunc(test.f)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestANSIPadding(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"\x1b[31mred\nb\nc\n", "\x1b[31mred\x1b[0m c\nb\n"},
+		{"\x1b[31mred\x1b[0m\nb\nc\n", "\x1b[31mred\x1b[0m c\nb\n"},
+		{"\x1b[41mr\nbbb\nc\nd\n", "\x1b[41mr\x1b[0m   c\nbbb d\n"},
+		{"\x1b[1;31mr\x1b[m\nbbb\nc\nd\n", "\x1b[1;31mr\x1b[m   c\nbbb d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetANSIAware(true)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestGroupOnBlank(t *testing.T) {
+	tests := []struct {
+		width    int
+		numbered bool
+		input    string
+		want     string
+	}{
+		{8, false, "a\nb\nc\n", "a b c\n"},
+		{8, false, "a\nb\n\nccc\nd\ne\nf\n", "a b\n\nccc e f\nd\n"},
+		{8, false, "a\n\n\nb\n", "a\n\n\nb\n"},
+		{8, false, "\na\n", "\na\n"},
+		{20, true, "a\nb\n\nc\nd\n", "1 a 2 b\n\n3 c 4 d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetGroupOnBlank(true)
+		w.SetNumbered(test.numbered)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("numbered %v, input %q: got %q, want %q", test.numbered, test.input, got, test.want)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		n     int
+		order Order
+		input string
+		want  string
+	}{
+		{2, ColumnMajor, "a\nb\nc\nd\n", "a c\nb d\n"},
+		{3, ColumnMajor, "aaaaaaaa\nb\nc\n", "aaaaaaaa b c\n"},
+		{4, ColumnMajor, "a\nb\nc\nd\ne\n", "a c d e\nb\n"},
+		{3, ColumnMajor, "a\nb\nc\nd\ne\nf\ng\n", "a d f\nb e g\nc\n"},
+		{4, RowMajor, "a\nb\nc\nd\ne\n", "a b c d\ne\n"},
+		{3, ColumnMajor, "a\n", "a\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 4)
+		w.SetOrder(test.order)
+		w.SetMaxColumns(1)
+		w.SetColumns(test.n)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("n %d, input %q: got %q, want %q", test.n, test.input, got, test.want)
+		}
+	}
+}
+
+func TestRecordSeparator(t *testing.T) {
+	tests := []struct {
+		sep   string
+		input string
+		want  string
+	}{
+		{"\x00", "a\x00b\x00c\x00", "a b c\n"},
+		{"\x00", "a\x00b\x00c", "a b c\n"},
+		{"\x00", "a\x00\x00c\x00", "a  c\n"},
+		{", ", "a, b, c", "a b c\n"},
+		{"", "a\r\nb\n", "a b\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 10)
+		w.SetRecordSeparator(test.sep)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("sep %q, input %q: got %q, want %q", test.sep, test.input, got, test.want)
+		}
+	}
+}
+
+func TestRTL(t *testing.T) {
+	tests := []struct {
+		order Order
+		input string
+		want  string
+		rows  [][]string
+	}{
+		{ColumnMajor, "a\nb\nc\n", "c b a\n", [][]string{{"c", "b", "a"}}},
+		{ColumnMajor, "a\nb\nc\nd\ne\n", "e c a\n  d b\n", [][]string{{"e", "c", "a"}, {"", "d", "b"}}},
+		{RowMajor, "a\nb\nc\nd\ne\n", "c b a\n  e d\n", [][]string{{"c", "b", "a"}, {"", "e", "d"}}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetOrder(test.order)
+		w.SetRTL(true)
+		io.WriteString(w, test.input)
+		if got := w.Layout(); !reflect.DeepEqual(got, test.rows) {
+			t.Errorf("order %d, input %q: got layout %q, want %q", test.order, test.input, got, test.rows)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("order %d, input %q: got %q, want %q", test.order, test.input, got, test.want)
+		}
+	}
+}
+
+func TestFitColumns(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 80)
+	io.WriteString(w, "aa\nbb\ncc\ndd\n")
+	tests := []struct {
+		width int
+		want  int
+	}{
+		{80, 4},
+		{12, 4},
+		{11, 3},
+		{6, 2},
+		{5, 1},
+		{0, 1},
+	}
+	for _, test := range tests {
+		if got := w.FitColumns(test.width); got != test.want {
+			t.Errorf("width %d: got %d columns, want %d", test.width, got, test.want)
+		}
+	}
+	if got := w.Width(); got != 80 {
+		t.Errorf("FitColumns changed the width to %d", got)
+	}
+	columnate(t, w, "")
+	if got, want := buf.String(), "aa bb cc dd\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRowsFor(t *testing.T) {
+	w := NewWriter(io.Discard, 80)
+	w.WriteString("a\nb\nc\nd\ne\nf\ng\n")
+	tests := []struct {
+		n, want int
+	}{
+		{1, 7}, {2, 4}, {3, 3}, {4, 2}, {7, 1}, {10, 1}, {0, 1},
+	}
+	for _, test := range tests {
+		if got := w.RowsFor(test.n); got != test.want {
+			t.Errorf("RowsFor(%d) = %d, want %d", test.n, got, test.want)
+		}
+	}
+	w.SetBalanced(false)
+	if got := w.RowsFor(3); got != 3 {
+		t.Errorf("unbalanced: RowsFor(3) = %d, want 3", got)
+	}
+	w.SetMaxRows(2)
+	if got := w.RowsFor(1); got != 2 {
+		t.Errorf("with SetMaxRows(2): RowsFor(1) = %d, want 2", got)
+	}
+	w.SetMaxRows(0)
+	w.SetColumns(2)
+	if got := w.RowsFor(0); got != 4 {
+		t.Errorf("with SetColumns(2): RowsFor(0) = %d, want 4", got)
+	}
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		width   int
+		columns int
+		input   string
+		want    bool
+	}{
+		{10, 0, "a\nbb\nccc\n", true},
+		{10, 0, "a\nbbbbbbbbbb\nc\n", true},
+		{10, 0, "a\nbbbbbbbbbbb\nc\n", false},
+		{0, 0, "a\nbbbbbbbbbbb\nc\n", true},
+		{6, 3, "aa\nbb\ncc\n", false},
+		{6, 3, "a\nb\nc\n", true},
+		{10, 0, "", true},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		w.SetColumns(test.columns)
+		w.WriteString(test.input)
+		if got := w.Fits(); got != test.want {
+			t.Errorf("width %d, columns %d, input %q: Fits() = %v, want %v", test.width, test.columns, test.input, got, test.want)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if test.input != "" && buf.Len() == 0 {
+			t.Errorf("width %d, columns %d, input %q: nothing written", test.width, test.columns, test.input)
+		}
+	}
+}
+
+func TestSpanningLines(t *testing.T) {
+	tests := []struct {
+		maxcell  int
+		numbered bool
+		input    string
+		want     string
+	}{
+		{0, false, "== heading ==\na\nb\nc\n== two ==\ndd\n", "== heading ==\na b c\n== two ==\ndd\n"},
+		{0, false, "a\nb\n== x\nc\nd\ne\nf\n", "a b\n== x\nc e f\nd\n"},
+		{1, false, "== heading ==\naa\nbb\n", "== heading ==\n… …\n"},
+		{0, true, "== X ==\na\nb\n== Y ==\nc\n", "== X ==\n1 a\n2 b\n== Y ==\n3 c\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetMaxCellWidth(test.maxcell)
+		w.SetNumbered(test.numbered)
+		w.SetSpanningLines(func(line string) bool {
+			return strings.HasPrefix(line, "==")
+		})
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("maxcell %d, numbered %v, input %q: got %q, want %q", test.maxcell, test.numbered, test.input, got, test.want)
+		}
+	}
+}
+
+func TestAutoFlushLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 10)
+	w.SetAutoFlushLines(3)
+	io.WriteString(w, "a\nb\n")
+	if buf.Len() != 0 {
+		t.Fatalf("flushed early: %q", buf.String())
+	}
+	io.WriteString(w, "c\ndddd\neeee\nf")
+	if got, want := buf.String(), "a dddd\nb eeee\nc\n"; got != want {
+		t.Errorf("after threshold: got %q, want %q", got, want)
+	}
+	w.WriteByte('f')
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "a dddd\nb eeee\nc\nff\n"; got != want {
+		t.Errorf("after Flush: got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	w.SetRecordSeparator("\x00")
+	w.ReadFrom(strings.NewReader("a\x00b\x00c\x00d"))
+	if got, want := buf.String(), "a b c\n"; got != want {
+		t.Errorf("ReadFrom: got %q, want %q", got, want)
+	}
+}
+
+func TestAutoFlushHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 10)
+	w.SetHeader(true)
+	w.SetAutoFlushLines(3)
+	for _, line := range []string{"NAME", "a", "b", "c", "d", "e", "f"} {
+		io.WriteString(w, line+"\n")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "NAME NAME\n---- ----\na    b\nNAME NAME\n---- ----\nc    e\nd\nNAME\n----\nf\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	io.WriteString(w, "SIZE\n1\n")
+	w.Flush()
+	if got, want := buf.String(), "SIZE\n----\n1\n"; got != want {
+		t.Errorf("after Flush: got %q, want %q", got, want)
+	}
+}
+
+func TestTableFromFields(t *testing.T) {
+	tests := []struct {
+		sep   string
+		input string
+		want  string
+	}{
+		{"\t", "name\tsize\tdate\nmain.go\t1024\tMay 1\n", "name    size date\nmain.go 1024 May 1\n"},
+		{"\t", "a\tb\nccc\ndd\te\n", "a   b\nccc\ndd  e\n"},
+		{"", "name  size\nmain.go   1024\n", "name    size\nmain.go 1024\n"},
+		{",", "a,b\n\nc,d\n", "a b\n\nc d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 10)
+		w.SetTableFromFields(test.sep)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("sep %q, input %q: got %q, want %q", test.sep, test.input, got, test.want)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		format Format
+		width  int
+		limit  int
+		row    int
+		col    int
+	}{
+		{Text, 5, 0, 0, 0},
+		{Text, 5, 2, 0, 1},
+		{Text, 5, 5, 1, 0},
+		{Text, 5, 6, 1, 1},
+		{Table, 6, 12, 1, 0},
+	}
+
+	for _, test := range tests {
+		w := NewWriter(&shortWriter{n: test.limit}, test.width)
+		w.SetFormat(test.format)
+		io.WriteString(w, "a\nb\nc\nd\n")
+		err := w.Flush()
+		var we *WriteError
+		if !errors.As(err, &we) {
+			t.Errorf("format %d, limit %d: got %v, want a *WriteError", test.format, test.limit, err)
+			continue
+		}
+		if we.Row != test.row || we.Column != test.col || we.Err != io.ErrShortWrite {
+			t.Errorf("format %d, limit %d: got %v, want row %d, column %d", test.format, test.limit, err, test.row, test.col)
+		}
+	}
+}
+
+func TestNoTrailingNewline(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+		want   string
+	}{
+		{Text, "a\nb\n", "a b"},
+		{Table, "a\nb\n", "┌───┬───┐\n│ a │ b │\n└───┴───┘"},
+		{Markdown, "a\nb\n", "| a   | b   |\n| --- | --- |"},
+		{Text, "a\tb\nc\nd\n", "a b\nc d"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetFormat(test.format)
+		w.SetBorder(true)
+		w.SetFieldDelimiter("\t")
+		w.SetTrailingNewline(false)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("format %d, input %q: got %q, want %q", test.format, test.input, got, test.want)
+		}
+	}
+}
+
+func TestMinCellWidth(t *testing.T) {
+	tests := []struct {
+		min   int
+		input string
+		want  string
+	}{
+		{0, "a\nb\nc\nd\n", "a b c d\n"},
+		{5, "a\nb\nc\nd\n", "a     b     c\nd\n"},
+		{5, "abcdefg\nb\n", "abcdefg b\n"},
+		{5, "a\tb\nc\td\n", "a     b\nc     d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetOrder(RowMajor)
+		w.SetFieldDelimiter("\t")
+		w.SetMinCellWidth(test.min)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("min %d, input %q: got %q, want %q", test.min, test.input, got, test.want)
+		}
+	}
+}
+
+func TestCellPadding(t *testing.T) {
+	tests := []struct {
+		format      Format
+		left, right int
+		input       string
+		want        string
+	}{
+		{Text, 0, 0, "a\nb\nc\n", "a b c\n"},
+		{Text, 1, 1, "a\nb\nc\n", " a   b   c\n"},
+		{Text, 1, 1, "aa\nbb\ncc\n", " aa   cc\n bb\n"},
+		{Table, 1, 1, "a\nb\n", "┌─────┬─────┐\n│  a  │  b  │\n└─────┴─────┘\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 14)
+		w.SetFormat(test.format)
+		w.SetBorder(true)
+		w.SetCellPadding(test.left, test.right)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("padding %d/%d, input %q: got %q, want %q", test.left, test.right, test.input, got, test.want)
+		}
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	tests := []struct {
+		align Align
+		input string
+		want  string
+	}{
+		{Left, "parent\n  child\n  child2\nother\n", "parent    child2\n  child other\n"},
+		{Right, "parent\n  child\n", "parent   child\n"},
+		{Left, "a\n\tb\n", "a         b\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 18)
+		w.SetAlign(test.align)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("align %d, input %q: got %q, want %q", test.align, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSingleLineWhenFits(t *testing.T) {
+	tests := []struct {
+		oneline bool
+		input   string
+		want    string
+	}{
+		{false, "a\nb\nc\n", "a  c\nb\n"},
+		{true, "a\nb\nc\n", "a b c\n"},
+		{true, "aaaa\nbbbb\ncccc\n", "aaaa cccc\nbbbb\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 12)
+		w.SetMinCellWidth(2)
+		w.SetMaxColumns(2)
+		w.SetSingleLineWhenFits(test.oneline)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("oneline %v, input %q: got %q, want %q", test.oneline, test.input, got, test.want)
+		}
+	}
+}
+
+func TestColumnAligns(t *testing.T) {
+	tests := []struct {
+		aligns []Align
+		input  string
+		want   string
+	}{
+		{nil, "a\tbbb\tccc\naaa\tb\tc\n", "a   bbb ccc\naaa b   c\n"},
+		{[]Align{Left, Right, Center}, "a\tbbb\tccc\naaa\tb\tc\n", "a   bbb ccc\naaa   b  c\n"},
+		{[]Align{Right}, "a\tbbb\tccc\naaa\tb\tc\n", "  a bbb ccc\naaa b   c\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		w.SetTableFromFields("\t")
+		w.SetColumnAligns(test.aligns)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("aligns %v, input %q: got %q, want %q", test.aligns, test.input, got, test.want)
+		}
+	}
+}
+
+func TestSetColumnWidths(t *testing.T) {
+	tests := []struct {
+		widths []int
+		spill  bool
+		fields bool
+		input  string
+		want   string
+	}{
+		{[]int{3, 4}, false, false, "a\nbb\nc\ndddddd\n", "a   c\nbb  ddd…\n"},
+		{[]int{3, 4}, true, false, "a\nbb\nc\ndddddd\n", "a   c\nbb  dddddd\n"},
+		{[]int{0, 2, 2}, false, false, "aaaa\nb\nc\n", "aaaa b  c\n"},
+		{[]int{2, 2}, false, true, "aaa\tb\tc\nd\te\tf\n", "a… b  c\nd  e  f\n"},
+		{[]int{2, 2}, true, true, "aaa\tb\tc\nd\te\tf\n", "aaa b  c\nd  e  f\n"},
+		{nil, false, false, "a\nbb\nc\ndddddd\n", "a bb c dddddd\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 20)
+		if test.fields {
+			w.SetTableFromFields("\t")
+		}
+		w.SetColumnWidths(test.widths)
+		w.SetCellOverflow(test.spill)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("widths %v, overflow %v, input %q: got %q, want %q", test.widths, test.spill, test.input, got, test.want)
+		}
+	}
+}
+
+func TestZebra(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	const even, odd = "\x1b[7m", "\x1b[1m"
+	tests := []struct {
+		even, odd string
+		input     string
+		want      string
+	}{
+		{"", "", "a\nbb\nc\n", "a  c\nbb\n"},
+		{even, odd, "a\nbb\nc\n", even + "a  c" + sgrReset + "\n" + odd + "bb  " + sgrReset + "\n"},
+		{"", odd, "a\nbb\nc\n", "a  c\n" + odd + "bb  " + sgrReset + "\n"},
+		{even, "", "\x1b[31ma\x1b[0m\nb\n", even + "\x1b[31ma\x1b[0m" + even + " b" + sgrReset + "\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 5)
+		w.SetANSIAware(true)
+		w.SetZebra(test.even, test.odd)
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("zebra %q %q, input %q: got %q, want %q", test.even, test.odd, test.input, got, test.want)
+		}
+	}
+}
+
+func TestNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	tests := []struct {
+		force bool
+		want  string
+	}{
+		{false, "a  c\nbb\n"},
+		{true, "\x1b[7ma  c" + sgrReset + "\nbb  \n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 5)
+		w.SetZebra("\x1b[7m", "")
+		w.SetForceColor(test.force)
+		columnate(t, w, "a\nbb\nc\n")
+		if got := buf.String(); got != test.want {
+			t.Errorf("force %v: got %q, want %q", test.force, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	const decomposed = "é"
+	tests := []struct {
+		normalize bool
+		input     string
+		want      string
+	}{
+		{false, "é\nf\n" + decomposed + "\n", decomposed + "\nf\né\n"},
+		{true, "é\nf\n" + decomposed + "\n", "f\né\né\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 1)
+		w.SetSort(true)
+		if test.normalize {
+			w.SetNormalize(norm.NFC)
+		}
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("normalize %v, input %q: got %q, want %q", test.normalize, test.input, got, test.want)
+		}
+	}
+}
+
+func TestLastColumns(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 6)
+	if got := w.LastColumns(); got != 0 {
+		t.Errorf("before Flush: got %d, want 0", got)
+	}
+	columnate(t, w, "a\nb\nc\n")
+	if got := w.LastColumns(); got != 3 {
+		t.Errorf("after Flush: got %d, want 3", got)
+	}
+	columnate(t, w, "aaaa\nb\n")
+	if got := w.LastColumns(); got != 1 {
+		t.Errorf("after second Flush: got %d, want 1", got)
+	}
+	w.Reset()
+	if got := w.LastColumns(); got != 0 {
+		t.Errorf("after Reset: got %d, want 0", got)
+	}
+}
+
+func TestDecimalAlign(t *testing.T) {
+	tests := []struct {
+		fields bool
+		width  int
+		input  string
+		want   string
+	}{
+		{false, 0, "1.5\n12.25\n7\n", " 1.5\n12.25\n 7\n"},
+		{false, 0, "100\n0.5\n", "100\n  0.5\n"},
+		{true, 0, "1.5\tx\n12.25\ty\n7\tz\n", " 1.5  x\n12.25 y\n 7    z\n"},
+		{false, 12, "1.5\n12\n3.25\n44\n5.125\n66\n", " 1.5\n12\n 3.25\n44\n 5.125\n66\n"},
+		{false, 13, "1.5\n12\n3.25\n44\n5.125\n66\n", " 1.5  44\n12     5.125\n 3.25 66\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.width)
+		if test.fields {
+			w.SetTableFromFields("\t")
+			w.SetColumnAligns([]Align{DecimalAlign})
+		} else {
+			w.SetAlign(DecimalAlign)
+		}
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("width %d, input %q: got %q, want %q", test.width, test.input, got, test.want)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			if test.width > 0 && utf8.RuneCountInString(line) >= test.width {
+				t.Errorf("width %d, input %q: line %q is too wide", test.width, test.input, line)
+			}
+		}
+	}
+}
+
+func TestMaxRows(t *testing.T) {
+	tests := []struct {
+		max      int
+		overflow string
+		input    string
+		want     string
+	}{
+		{0, "", "a\nb\nc\nd\ne\n", "a c e\nb d\n"},
+		{2, "", "a\nb\nc\nd\ne\n", "a c e\nb d\n"},
+		{1, "", "a\nb\nc\nd\ne\n", "a c e\n… and 2 more\n"},
+		{1, "(%d hidden)", "a\nb\nc\nd\ne\n", "a c e\n(2 hidden)\n"},
+		{1, "", "aaaaaa\nb\nc\nd\n", "aaaaaa\n… and 3 more\n"},
+		{1, "", "a,b,c\nd,e,f\ng,,\n", "a b c\n… and 2 more\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 6)
+		w.SetFieldDelimiter(",")
+		w.SetMaxRows(test.max)
+		if test.overflow != "" {
+			w.SetOverflowFormat(test.overflow)
+		}
+		columnate(t, w, test.input)
+		if got := buf.String(); got != test.want {
+			t.Errorf("max %d, input %q: got %q, want %q", test.max, test.input, got, test.want)
+		}
+	}
+}
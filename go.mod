@@ -0,0 +1,10 @@
+module sigint.ca/text
+
+go 1.24.0
+
+require (
+	golang.org/x/term v0.40.0
+	golang.org/x/text v0.34.0
+)
+
+require golang.org/x/sys v0.41.0 // indirect